@@ -0,0 +1,206 @@
+package netmd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	omaHeaderSize = 96   // size of the EA3 header that follows the ea3 tag
+	aeaHeaderSize = 2048 // size of the header of an ATRAC1 .aea file
+)
+
+// aeaMagic starts every .aea file, it is the header size as little-endian uint32
+var aeaMagic = []byte{0x00, 0x08, 0x00, 0x00}
+
+// NewTrackFromATRAC3 prepares a headerless stream of ATRAC3 frames from r (of size bytes) for format WfLP2 or WfLP4,
+// the data is sent as is so it must hold whole frames encoded in the given mode
+func (md *NetMD) NewTrackFromATRAC3(title string, r io.Reader, size int64, format WireFormat) (trk *Track, err error) {
+	if size < 0 {
+		return nil, errors.New("atrac3: stream size unknown")
+	}
+	trk = newTrack(title)
+	switch format {
+	case WfLP2:
+		trk.DiscFormat = DfLP2
+	case WfLP4:
+		trk.DiscFormat = DfLP4
+	default:
+		return nil, errors.New("atrac3: format must be WfLP2 or WfLP4")
+	}
+	// an ATRAC3 frame is two of the frames the wire format counts in
+	if frameSize := 2 * FrameSize[format]; size%int64(frameSize) != 0 {
+		return nil, fmt.Errorf("atrac3: stream size %d is not a multiple of the %d bytes frame size", size, frameSize)
+	}
+	trk.Format = format
+	trk.size = int(size)
+	trk.source = io.LimitReader(r, size)
+
+	if err = md.prepareTrack(trk); err != nil {
+		return nil, err
+	}
+	return
+}
+
+// readOMA sets the format and audio source of trk from the OpenMG (.oma/.omg) file in r, it starts with an ea3 tag
+// holding the metadata (an id3v2 tag with a different magic) followed by the EA3 header and the ATRAC3 frames
+func (trk *Track) readOMA(r io.Reader, size int64) error {
+	if size < 0 {
+		return errors.New("oma: file size unknown")
+	}
+	read := int64(0)
+
+	tag := make([]byte, 10)
+	if _, err := io.ReadFull(r, tag); err != nil {
+		return fmt.Errorf("oma: truncated header: %w", err)
+	}
+	read += 10
+
+	var h []byte
+	if string(tag[0:3]) == "ea3" {
+		body := make([]byte, syncSafe(tag[6:10]))
+		if _, err := io.ReadFull(r, body); err != nil {
+			return fmt.Errorf("oma: truncated ea3 tag: %w", err)
+		}
+		read += int64(len(body))
+		trk.Metadata = parseID3(append(tag, body...))
+
+		h = make([]byte, omaHeaderSize)
+		if _, err := io.ReadFull(r, h); err != nil {
+			return fmt.Errorf("oma: truncated EA3 header: %w", err)
+		}
+	} else {
+		// the ea3 tag is optional, the header was already partly read
+		h = append(tag, make([]byte, omaHeaderSize-len(tag))...)
+		if _, err := io.ReadFull(r, h[len(tag):]); err != nil {
+			return fmt.Errorf("oma: truncated EA3 header: %w", err)
+		}
+		read -= 10
+	}
+	read += omaHeaderSize
+
+	if string(h[0:3]) != "EA3" || h[4] != 0x00 || h[5] != omaHeaderSize {
+		return errors.New("oma: EA3 header not found")
+	}
+	if id := binary.BigEndian.Uint16(h[6:8]); id != 0xffff && id != 0xff80 {
+		return errors.New("oma: encrypted oma files are not supported")
+	}
+	if h[32] != 0x00 {
+		return fmt.Errorf("oma: codec %d not supported, must be atrac3 (0)", h[32])
+	}
+	params := int(h[33])<<16 | int(h[34])<<8 | int(h[35])
+	if (params>>13)&0x07 != 1 {
+		return errors.New("oma: sample rate must be 44100")
+	}
+	switch (params & 0x3ff) * 8 {
+	case 384:
+		trk.Format = WfLP2
+		trk.DiscFormat = DfLP2
+	case 192:
+		trk.Format = WfLP4
+		trk.DiscFormat = DfLP4
+	default:
+		return errors.New("oma: frame size not supported, must be 384 (LP2) or 192 (LP4)")
+	}
+
+	trk.size = int(size - read)
+	if trk.size <= 0 {
+		return errors.New("oma: no audio data")
+	}
+	trk.source = io.LimitReader(r, int64(trk.size))
+	return nil
+}
+
+// aeaHeader is the header of an ATRAC1 (.aea) file
+type aeaHeader struct {
+	title    string
+	frames   int // sound groups of a sound unit per channel
+	channels int
+}
+
+// discFormat returns DfMonoSP or DfStereoSP
+func (h *aeaHeader) discFormat() DiscFormat {
+	if h.channels == 1 {
+		return DfMonoSP
+	}
+	return DfStereoSP
+}
+
+// readAEAHeader reads the 2048 bytes header of an .aea file
+func readAEAHeader(r io.Reader) (*aeaHeader, error) {
+	b := make([]byte, aeaHeaderSize)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, fmt.Errorf("aea: truncated header: %w", err)
+	}
+	if binary.LittleEndian.Uint32(b[0:4]) != aeaHeaderSize {
+		return nil, errors.New("aea: header not found")
+	}
+	title := b[4:260]
+	if i := bytes.IndexByte(title, 0); i != -1 {
+		title = title[:i]
+	}
+	h := &aeaHeader{
+		title:    strings.TrimSpace(string(title)),
+		frames:   int(binary.LittleEndian.Uint32(b[260:264])),
+		channels: int(b[264]),
+	}
+	if h.channels != 1 && h.channels != 2 {
+		return nil, errors.New("aea: must be mono or stereo")
+	}
+	return h, nil
+}
+
+// readAEA sets trk to the pcm decoded from the ATRAC1 (.aea) file in r with the registered Codec, NetMD only accepts SP as pcm
+func (trk *Track) readAEA(r io.Reader, size int64) error {
+	c, err := registeredCodec()
+	if err != nil {
+		return err
+	}
+	h, err := readAEAHeader(r)
+	if err != nil {
+		return err
+	}
+	frames := h.frames
+	if size >= 0 {
+		frames = int(size-aeaHeaderSize) / (soundUnitSize * h.channels)
+	}
+	src, err := c.NewDecoder(r, frames, h.discFormat())
+	if err != nil {
+		return err
+	}
+	trk.Metadata = &Metadata{Title: h.title}
+	trk.DiscFormat = h.discFormat()
+	trk.size = frames * spFrameSamples * 2 * h.channels
+	trk.source = src
+	return nil
+}
+
+// WriteAEA writes the ATRAC1 sound units of an SP track in r (of size bytes) as an .aea file to w,
+// channels is 1 for mono and 2 for stereo
+func WriteAEA(w io.Writer, title string, channels int, r io.Reader, size int64) error {
+	if channels != 1 && channels != 2 {
+		return errors.New("aea: must be mono or stereo")
+	}
+	group := int64(soundUnitSize * channels)
+	if size < 0 || size%group != 0 {
+		return fmt.Errorf("aea: size %d is not a multiple of the %d bytes sound group", size, group)
+	}
+
+	h := make([]byte, aeaHeaderSize)
+	copy(h, aeaMagic)
+	if len(title) > 255 {
+		title = title[:255]
+	}
+	copy(h[4:260], title)
+	binary.LittleEndian.PutUint32(h[260:264], uint32(size/group))
+	h[264] = byte(channels)
+	if _, err := w.Write(h); err != nil {
+		return err
+	}
+	_, err := io.CopyN(w, r, size)
+	return err
+}
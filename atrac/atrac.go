@@ -0,0 +1,90 @@
+// This library is free software; you can redistribute it and/or modify it under the terms of the GNU Lesser General
+// Public License as published by the Free Software Foundation; either version 2.1 of the License, or (at your option)
+// any later version.
+//
+// This library is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+// warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Lesser General Public License in the
+// LICENSE file of this directory for more details.
+
+// Package atrac holds the ATRAC1 (SP) decoder and the ATRAC3 (LP2 and LP4) encoder and decoder of netmd, it is derived
+// from FFmpeg and licensed under the LGPL 2.1 or later, unlike the MIT licensed rest of the module
+package atrac
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	// SoundUnitSize is the size of one ATRAC1 sound unit, an SP frame holds one per channel
+	SoundUnitSize = atrac1SUSize
+	// SPFrameSamples is the number of samples per channel of an ATRAC1 frame
+	SPFrameSamples = atrac1FrameSamples
+	// LPFrameSamples is the number of samples per channel of an ATRAC3 frame
+	LPFrameSamples = atrac3FrameSamples
+)
+
+// Format is the frame layout of ATRAC3 audio
+type Format int
+
+const (
+	LP2 Format = iota // both channels in their own half of a 384 bytes frame
+	LP4               // joint stereo in a 192 bytes frame
+)
+
+// FrameSize returns the size of one ATRAC3 frame of f
+func (f Format) FrameSize() int {
+	if f == LP4 {
+		return atrac3FrameSizeLP4
+	}
+	return atrac3FrameSizeLP2
+}
+
+func (f Format) valid() error {
+	if f != LP2 && f != LP4 {
+		return errors.New("atrac3: format must be LP2 or LP4")
+	}
+	return nil
+}
+
+// NewSPDecoder returns a reader that decodes frames ATRAC1 frames of one sound unit per channel from src into
+// little-endian 16 bit pcm
+func NewSPDecoder(src io.Reader, channels, frames int) (io.Reader, error) {
+	dec, err := newATRAC1Decoder(channels)
+	if err != nil {
+		return nil, err
+	}
+	return &atrac1Reader{src: src, frames: frames, dec: dec}, nil
+}
+
+// NewLPDecoder returns a reader that decodes frames ATRAC3 frames of format f from src into little-endian 16 bit
+// stereo pcm, the error of a corrupt frame holds its position
+func NewLPDecoder(src io.Reader, frames int, f Format) (io.Reader, error) {
+	dec, err := newATRAC3Decoder(f)
+	if err != nil {
+		return nil, err
+	}
+	return &atrac3PCMReader{src: src, frames: frames, dec: dec}, nil
+}
+
+// NewLPEncoder returns a reader that encodes samples per channel of little-endian 16 bit mono or stereo pcm from src
+// into ATRAC3 frames of format f
+func NewLPEncoder(src io.Reader, channels, samples int, f Format) (*LPEncoder, error) {
+	if channels != 1 && channels != 2 {
+		return nil, fmt.Errorf("atrac3: %d channels, must be mono or stereo", channels)
+	}
+	enc, err := newATRAC3Encoder(f)
+	if err != nil {
+		return nil, err
+	}
+	frames := atrac3Frames(samples)
+	return &LPEncoder{
+		src:      src,
+		channels: channels,
+		samples:  samples,
+		frames:   frames,
+		size:     frames * enc.frameSize,
+		enc:      enc,
+	}, nil
+}
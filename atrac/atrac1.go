@@ -0,0 +1,259 @@
+// The ATRAC1 decoder is derived from libavcodec/atrac1.c and atrac.c of FFmpeg,
+// Copyright (c) 2009 Maxim Poliakovski and Benjamin Larsson.
+//
+// This library is free software; you can redistribute it and/or modify it under the terms of the GNU Lesser General
+// Public License as published by the Free Software Foundation; either version 2.1 of the License, or (at your option)
+// any later version.
+//
+// This library is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+// warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Lesser General Public License in the
+// LICENSE file of this directory for more details.
+
+package atrac
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+)
+
+// ATRAC1 (SP) sound units hold 512 samples of one channel in 212 bytes, the audio is split by a qmf filter bank into a
+// low and mid band of 128 samples and a high band of 256 samples which are transformed in one long or several short blocks
+const (
+	atrac1SUSize       = 212
+	atrac1FrameSamples = 512
+	atrac1MaxBFU       = 52
+)
+
+var (
+	atrac1BFUAmount   = [8]int{20, 28, 32, 36, 40, 44, 48, 52}
+	atrac1BandSamples = [3]int{128, 128, 256}
+	atrac1BandBFUs    = [4]int{0, 20, 36, 52}
+
+	// atrac1SpecsPerBFU holds the number of spectral lines of every block floating unit
+	atrac1SpecsPerBFU = [atrac1MaxBFU]int{
+		8, 8, 8, 8, 4, 4, 4, 4, 8, 8, 8, 8, 6, 6, 6, 6, 6, 6, 6, 6,
+		6, 6, 6, 6, 7, 7, 7, 7, 9, 9, 9, 9, 10, 10, 10, 10,
+		12, 12, 12, 12, 12, 12, 12, 12, 20, 20, 20, 20, 20, 20, 20, 20,
+	}
+
+	// atrac1StartLong and atrac1StartShort hold the first spectral line of every block floating unit in long and short blocks
+	atrac1StartLong = [atrac1MaxBFU]int{
+		0, 8, 16, 24, 32, 36, 40, 44, 48, 56, 64, 72, 80, 86, 92, 98, 104, 110, 116, 122,
+		128, 134, 140, 146, 152, 159, 166, 173, 180, 189, 198, 207, 216, 226, 236, 246,
+		256, 268, 280, 292, 304, 316, 328, 340, 352, 372, 392, 412, 432, 452, 472, 492,
+	}
+	atrac1StartShort = [atrac1MaxBFU]int{
+		0, 32, 64, 96, 8, 40, 72, 104, 12, 44, 76, 108, 20, 52, 84, 116, 26, 58, 90, 122,
+		128, 160, 192, 224, 134, 166, 198, 230, 141, 173, 205, 237, 150, 182, 214, 246,
+		256, 288, 320, 352, 384, 416, 448, 480, 268, 300, 332, 364, 396, 428, 460, 492,
+	}
+
+	atrac1SineWindow [32]float64
+)
+
+func init() {
+	for i := range atrac1SineWindow {
+		atrac1SineWindow[i] = math.Sin((float64(i) + 0.5) * math.Pi / 64)
+	}
+}
+
+// atrac1Unit is the decoder state of one channel
+type atrac1Unit struct {
+	log2Blocks [3]int
+	spectrum   [2][atrac1FrameSamples]float64 // imdct output of the current and previous frame
+	now        int
+	delay      [2][46]float64 // iqmf delays
+	highDelay  [39]float64    // the high band is delayed to line up with the merged low and mid band
+}
+
+// atrac1Decoder turns ATRAC1 frames of a sound unit per channel into pcm
+type atrac1Decoder struct {
+	units []*atrac1Unit
+}
+
+func newATRAC1Decoder(channels int) (*atrac1Decoder, error) {
+	if channels != 1 && channels != 2 {
+		return nil, errors.New("atrac1: must be mono or stereo")
+	}
+	d := &atrac1Decoder{}
+	for i := 0; i < channels; i++ {
+		d.units = append(d.units, &atrac1Unit{})
+	}
+	return d, nil
+}
+
+// decodeFrame decodes the sound units in frame into 512 samples per channel, scaled to 16 bits
+func (d *atrac1Decoder) decodeFrame(frame []byte, out [][]float64) error {
+	if len(frame) != atrac1SUSize*len(d.units) {
+		return errors.New("atrac1: wrong frame size")
+	}
+	for ch, u := range d.units {
+		if err := u.decode(frame[ch*atrac1SUSize:(ch+1)*atrac1SUSize], out[ch]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (u *atrac1Unit) decode(su []byte, out []float64) error {
+	// the last 2 bytes repeat the block size mode and info byte
+	if su[0] != su[atrac1SUSize-1] || su[1] != su[atrac1SUSize-2] {
+		return errors.New("atrac1: sound unit header copies differ")
+	}
+	br := &bitReader{buf: su}
+
+	// block size mode, the number of short blocks of every band
+	for i := 0; i < 2; i++ {
+		v := int(br.read(2))
+		if v&1 != 0 {
+			return errors.New("atrac1: invalid block size mode")
+		}
+		u.log2Blocks[i] = 2 - v
+	}
+	v := int(br.read(2))
+	if v != 0 && v != 3 {
+		return errors.New("atrac1: invalid block size mode")
+	}
+	u.log2Blocks[2] = 3 - v
+	br.read(2)
+
+	bfus := atrac1BFUAmount[br.read(3)]
+	br.read(5)
+	var wl, sf [atrac1MaxBFU]int
+	for i := 0; i < bfus; i++ {
+		wl[i] = int(br.read(4))
+	}
+	for i := 0; i < bfus; i++ {
+		sf[i] = int(br.read(6))
+	}
+
+	var spec [atrac1FrameSamples]float64
+	for band := 0; band < 3; band++ {
+		for i := atrac1BandBFUs[band]; i < atrac1BandBFUs[band+1]; i++ {
+			pos := atrac1StartLong[i]
+			if u.log2Blocks[band] != 0 {
+				pos = atrac1StartShort[i]
+			}
+			bits := wl[i]
+			if bits == 0 {
+				continue
+			}
+			bits++ // a word length index of n means n+1 bits
+			scale := atrac3SFTable[sf[i]] / float64(int(1)<<uint(bits-1)-1)
+			for j := 0; j < atrac1SpecsPerBFU[i]; j++ {
+				spec[pos+j] = float64(br.readSigned(bits)) * scale
+			}
+		}
+	}
+	if br.n > (atrac1SUSize-2)*8 {
+		return errors.New("atrac1: sound unit exceeds its size")
+	}
+
+	var bands [3][]float64
+	for i := range bands {
+		bands[i] = make([]float64, atrac1BandSamples[i])
+	}
+	u.synthesizeBands(spec[:], bands)
+
+	low := make([]float64, 256)
+	qmfSynthesis(bands[0], bands[1], low, u.delay[0][:])
+	high := append(u.highDelay[:], bands[2]...)
+	copy(u.highDelay[:], high[256:])
+	qmfSynthesis(low, high[:256], out, u.delay[1][:])
+	return nil
+}
+
+// synthesizeBands transforms the blocks of spec into the qmf bands, blocks overlap by 16 samples with a sine window
+func (u *atrac1Unit) synthesizeBands(spec []float64, bands [3][]float64) {
+	now, prev := &u.spectrum[u.now], &u.spectrum[1-u.now]
+	pos, ref := 0, 0
+	for band := 0; band < 3; band++ {
+		n := atrac1BandSamples[band]
+		blocks := 1 << uint(u.log2Blocks[band])
+		size := 32
+		if blocks == 1 {
+			size = n
+		}
+
+		last := prev[ref+n-16 : ref+n]
+		for j, start := 0, 0; j < blocks; j, start = j+1, start+size {
+			coefs := make([]float64, size)
+			copy(coefs, spec[pos:pos+size])
+			if band > 0 {
+				// the mid and high band are spectrally inverted by the qmf
+				for i := 0; i < size/2; i++ {
+					coefs[i], coefs[size-1-i] = coefs[size-1-i], coefs[i]
+				}
+			}
+			full := make([]float64, 2*size)
+			imdct(coefs, full)
+			block := now[ref+start : ref+start+size]
+			for i := range block {
+				block[i] = -full[size/2+i]
+			}
+
+			dst := bands[band][start : start+32]
+			for i := 0; i < 16; i++ {
+				s0, s1 := last[i], block[15-i]
+				wi, wj := atrac1SineWindow[i], atrac1SineWindow[31-i]
+				dst[i] = s0*wj - s1*wi
+				dst[31-i] = s0*wi + s1*wj
+			}
+			last = block[16:32]
+			pos += size
+		}
+		if blocks == 1 {
+			copy(bands[band][32:], now[ref+16:ref+n-16])
+		}
+		ref += n
+	}
+	u.now ^= 1
+}
+
+// atrac1Reader decodes the ATRAC1 frames of src into little-endian 16 bit pcm while it is read
+type atrac1Reader struct {
+	src    io.Reader
+	frames int
+	dec    *atrac1Decoder
+	buf    []byte
+}
+
+func (r *atrac1Reader) Read(p []byte) (int, error) {
+	if len(r.buf) == 0 {
+		if r.frames == 0 {
+			return 0, io.EOF
+		}
+		if err := r.decode(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+func (r *atrac1Reader) decode() error {
+	channels := len(r.dec.units)
+	frame := make([]byte, atrac1SUSize*channels)
+	if _, err := io.ReadFull(r.src, frame); err != nil {
+		return err
+	}
+	out := make([][]float64, channels)
+	for i := range out {
+		out[i] = make([]float64, atrac1FrameSamples)
+	}
+	if err := r.dec.decodeFrame(frame, out); err != nil {
+		return err
+	}
+	pcm := make([]byte, atrac1FrameSamples*2*channels)
+	for i := 0; i < atrac1FrameSamples; i++ {
+		for ch := range out {
+			binary.LittleEndian.PutUint16(pcm[(i*channels+ch)*2:], uint16(toInt16(out[ch][i])))
+		}
+	}
+	r.buf = pcm
+	r.frames--
+	return nil
+}
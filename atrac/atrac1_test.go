@@ -0,0 +1,132 @@
+package atrac
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+	"strings"
+	"testing"
+)
+
+// testSoundUnit returns a sound unit of long blocks that codes value at spectral line line of the first block
+// floating unit, it holds the lowest 8 lines of the low band which are 43 Hz apart
+func testSoundUnit(line, value int) []byte {
+	w := &bitWriter{}
+	w.write(2, 2) // low band long block
+	w.write(2, 2) // mid band long block
+	w.write(3, 2) // high band long block
+	w.write(0, 2)
+	w.write(0, 3) // 20 block floating units
+	w.write(0, 5)
+	for i := 0; i < 20; i++ {
+		if i == 0 && value != 0 {
+			w.write(3, 4) // 4 bit mantissas
+		} else {
+			w.write(0, 4)
+		}
+	}
+	for i := 0; i < 20; i++ {
+		w.write(40, 6)
+	}
+	if value != 0 {
+		for i := 0; i < atrac1SpecsPerBFU[0]; i++ {
+			v := 0
+			if i == line {
+				v = value
+			}
+			w.write(uint32(v)&0xf, 4)
+		}
+	}
+	su := make([]byte, atrac1SUSize)
+	copy(su, w.buf)
+	su[atrac1SUSize-1], su[atrac1SUSize-2] = su[0], su[1]
+	return su
+}
+
+// magnitude returns the strength of frequency f in the samples
+func magnitude(samples []float64, f float64) float64 {
+	var re, im float64
+	for i, s := range samples {
+		a := 2 * math.Pi * f * float64(i) / 44100
+		re += s * math.Cos(a)
+		im += s * math.Sin(a)
+	}
+	return math.Hypot(re, im)
+}
+
+func TestSPDecoder(t *testing.T) {
+	const frames = 8
+	for line := 0; line < 8; line += 3 {
+		// a single frame holds the line, the frames around it are silent
+		var stream []byte
+		for i := 0; i < frames; i++ {
+			if i == frames/2 {
+				stream = append(stream, testSoundUnit(line, 7)...)
+			} else {
+				stream = append(stream, testSoundUnit(0, 0)...)
+			}
+		}
+		dec, err := NewSPDecoder(bytes.NewReader(stream), 1, frames)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pcm, err := io.ReadAll(dec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(pcm) != frames*atrac1FrameSamples*2 {
+			t.Fatalf("decoded %d bytes, want %d", len(pcm), frames*atrac1FrameSamples*2)
+		}
+		out := make([]float64, len(pcm)/2)
+		for i := range out {
+			out[i] = float64(int16(binary.LittleEndian.Uint16(pcm[i*2:])))
+		}
+
+		peak, best := 0.0, 0.0
+		for f := 5.0; f < 1000; f += 5 {
+			if m := magnitude(out, f); m > best {
+				peak, best = f, m
+			}
+		}
+		want := (float64(line) + 0.5) * 44100 / 4 / 256
+		if math.Abs(peak-want) > 25 {
+			t.Fatalf("line %d decodes to a peak at %.0f Hz, want %.0f Hz", line, peak, want)
+		}
+	}
+}
+
+func TestSPDecoderErrors(t *testing.T) {
+	silence := testSoundUnit(0, 0)
+	tests := []struct {
+		name     string
+		channels int
+		data     func() []byte
+		err      string
+	}{
+		{"three channels", 3, func() []byte { return nil }, "must be mono or stereo"},
+		{"header copies differ", 1, func() []byte {
+			su := append([]byte(nil), silence...)
+			su[atrac1SUSize-1] ^= 0xff
+			return su
+		}, "header copies differ"},
+		{"odd block size mode", 1, func() []byte {
+			su := append([]byte(nil), silence...)
+			su[0] = 0x40 // low band mode 1
+			su[atrac1SUSize-1] = su[0]
+			return su
+		}, "invalid block size mode"},
+		{"truncated stereo frame", 2, func() []byte { return silence }, io.ErrUnexpectedEOF.Error()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dec, err := NewSPDecoder(bytes.NewReader(tt.data()), tt.channels, 1)
+			if err == nil {
+				_, err = io.ReadAll(dec)
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("error %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
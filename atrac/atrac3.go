@@ -0,0 +1,298 @@
+// The tables, qmf filter bank and transforms are derived from libavcodec/atrac.c, atrac3.c and atrac3data.h of FFmpeg,
+// Copyright (c) 2006-2008 Maxim Poliakovski and Benjamin Larsson.
+//
+// This library is free software; you can redistribute it and/or modify it under the terms of the GNU Lesser General
+// Public License as published by the Free Software Foundation; either version 2.1 of the License, or (at your option)
+// any later version.
+//
+// This library is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+// warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Lesser General Public License in the
+// LICENSE file of this directory for more details.
+
+package atrac
+
+import (
+	"math"
+	"math/cmplx"
+)
+
+// ATRAC3 frames hold 1024 samples per channel, the audio is split by a qmf filter bank into 4 bands of 256 samples
+// which are transformed with an mdct into one spectrum of 1024 lines that is quantized in 32 subbands
+const (
+	atrac3FrameSamples = 1024
+	atrac3BandSamples  = 256
+	atrac3Subbands     = 32
+
+	atrac3UnitID       = 0x28 // starts the sound unit of a channel
+	atrac3JointUnitID  = 0x03 // starts the second sound unit of a joint stereo frame
+	atrac3FrameSizeLP2 = 384  // two channels of 192 bytes
+	atrac3FrameSizeLP4 = 192  // joint stereo, both sound units share the frame
+)
+
+// atrac3SubbandTab holds the first spectral line of every subband
+var atrac3SubbandTab = [atrac3Subbands + 1]int{
+	0, 8, 16, 24, 32, 40, 48, 56,
+	64, 80, 96, 112, 128, 144, 160, 176,
+	192, 224, 256, 288, 320, 352, 384, 416,
+	448, 480, 512, 576, 640, 704, 768, 896,
+	1024,
+}
+
+// atrac3MaxQuant is the quantizer range of every word length selector, 0 means the subband is not coded
+var atrac3MaxQuant = [8]float64{0, 1.5, 2.5, 3.5, 4.5, 7.5, 15.5, 31.5}
+
+// atrac3CLCLength is the number of bits of a mantissa (a pair for selector 1) in constant length coding
+var atrac3CLCLength = [8]int{0, 4, 3, 3, 4, 4, 5, 6}
+
+// atrac3MantissaCLC maps the 2 bit values of a selector 1 pair in constant length coding
+var atrac3MantissaCLC = [4]int{0, 1, -2, -1}
+
+// atrac3MantissaVLC maps the huffman symbols of selector 1 to a pair of mantissas
+var atrac3MantissaVLC = [18]int{0, 0, 0, 1, 0, -1, 1, 0, -1, 0, 1, 1, 1, -1, -1, 1, -1, -1}
+
+// atrac3HuffCodes and atrac3HuffBits are the huffman tables of the selectors 1 to 7 indexed by symbol
+var (
+	atrac3HuffCodes = [7][]uint8{
+		{0x00, 0x04, 0x05, 0x0c, 0x0d, 0x1c, 0x1d, 0x1e, 0x1f},
+		{0x00, 0x04, 0x05, 0x06, 0x07},
+		{0x00, 0x04, 0x05, 0x0c, 0x0d, 0x0e, 0x0f},
+		{0x00, 0x04, 0x05, 0x0c, 0x0d, 0x1c, 0x1d, 0x1e, 0x1f},
+		{0x00, 0x02, 0x03, 0x08, 0x09, 0x0a, 0x0b, 0x1c, 0x1d, 0x3c, 0x3d, 0x3e, 0x3f, 0x0c, 0x0d},
+		{
+			0x00, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x14, 0x15, 0x16, 0x17, 0x18, 0x19, 0x34, 0x35, 0x36,
+			0x37, 0x38, 0x39, 0x3a, 0x3b, 0x78, 0x79, 0x7a, 0x7b, 0x7c, 0x7d, 0x7e, 0x7f, 0x08, 0x09,
+		},
+		{
+			0x00, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f, 0x10, 0x11, 0x24, 0x25, 0x26, 0x27, 0x28,
+			0x29, 0x2a, 0x2b, 0x2c, 0x2d, 0x2e, 0x2f, 0x30, 0x31, 0x32, 0x33, 0x68, 0x69, 0x6a, 0x6b, 0x6c,
+			0x6d, 0x6e, 0x6f, 0x70, 0x71, 0x72, 0x73, 0x74, 0x75, 0xec, 0xed, 0xee, 0xef, 0xf0, 0xf1, 0xf2,
+			0xf3, 0xf4, 0xf5, 0xf6, 0xf7, 0xf8, 0xf9, 0xfa, 0xfb, 0xfc, 0xfd, 0xfe, 0xff, 0x02, 0x03,
+		},
+	}
+	atrac3HuffBits = [7][]uint8{
+		{1, 3, 3, 4, 4, 5, 5, 5, 5},
+		{1, 3, 3, 3, 3},
+		{1, 3, 3, 4, 4, 4, 4},
+		{1, 3, 3, 4, 4, 5, 5, 5, 5},
+		{2, 3, 3, 4, 4, 4, 4, 5, 5, 6, 6, 6, 6, 4, 4},
+		{3, 4, 4, 4, 4, 4, 4, 5, 5, 5, 5, 5, 5, 6, 6, 6, 6, 6, 6, 6, 6, 7, 7, 7, 7, 7, 7, 7, 7, 4, 4},
+		{
+			3, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 6, 6, 6, 6, 6, 6, 6, 6, 6, 6, 6, 6, 6, 6, 6, 6, 7, 7, 7, 7, 7,
+			7, 7, 7, 7, 7, 7, 7, 7, 7, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 4, 4,
+		},
+	}
+)
+
+// qmfTapHalf is the first half of the symmetric 48 tap qmf filter shared by ATRAC1 and ATRAC3
+var qmfTapHalf = [24]float64{
+	-0.00001461907, -0.00009205479, -0.000056157569, 0.00030117269,
+	0.0002422519, -0.00085293897, -0.0005205574, 0.0020340169,
+	0.00078333891, -0.0042153862, -0.00075614988, 0.0078402944,
+	-0.000061169922, -0.01344162, 0.0024626821, 0.021736089,
+	-0.007801671, -0.034090221, 0.01880949, 0.054326009,
+	-0.043596379, -0.099384367, 0.13207909, 0.46424159,
+}
+
+// atrac3HuffLookup maps the next 8 bits of the stream to symbol<<4 | length for every huffman table
+var atrac3HuffLookup [7][256]uint16
+
+var (
+	atrac3SFTable      [64]float64 // scale factors, 2^((i-15)/3)
+	qmfWindow          [48]float64
+	atrac3MDCTWindow   [512]float64 // window applied after the imdct
+	atrac3EncodeWindow [512]float64 // window applied before the mdct
+)
+
+func init() {
+	for i := range atrac3SFTable {
+		atrac3SFTable[i] = math.Pow(2, float64(i-15)/3)
+	}
+	for t, codes := range atrac3HuffCodes {
+		for sym, code := range codes {
+			l := atrac3HuffBits[t][sym]
+			start := int(code) << (8 - l)
+			for v := start; v < start+1<<(8-l); v++ {
+				atrac3HuffLookup[t][v] = uint16(sym)<<4 | uint16(l)
+			}
+		}
+	}
+	for i, t := range qmfTapHalf {
+		qmfWindow[i] = t * 2
+		qmfWindow[47-i] = t * 2
+	}
+	for i, j := 0, 255; i < 128; i, j = i+1, j-1 {
+		wi := math.Sin(((float64(i)+0.5)/256-0.5)*math.Pi) + 1
+		wj := math.Sin(((float64(j)+0.5)/256-0.5)*math.Pi) + 1
+		w := 0.5 * (wi*wi + wj*wj)
+		atrac3MDCTWindow[i], atrac3MDCTWindow[511-i] = wi/w, wi/w
+		atrac3MDCTWindow[j], atrac3MDCTWindow[511-j] = wj/w, wj/w
+		atrac3EncodeWindow[i], atrac3EncodeWindow[511-i] = wi, wi
+		atrac3EncodeWindow[j], atrac3EncodeWindow[511-j] = wj, wj
+	}
+}
+
+// qmfAnalysis splits in into a lower and upper half band of len(in)/2 samples, delay holds the last 46 input samples,
+// qmfSynthesis restores the input delayed by 46 samples
+func qmfAnalysis(in, lower, upper, delay []float64) {
+	buf := make([]float64, 46+len(in))
+	copy(buf, delay)
+	copy(buf[46:], in)
+	for j := 0; j < len(in); j += 2 {
+		var lo, hi float64
+		for i := 0; i < 24; i++ {
+			lo += qmfWindow[2*i] * buf[47+j-2*i]
+			hi += qmfWindow[2*i+1] * buf[46+j-2*i]
+		}
+		lower[j/2] = (lo + hi) / 2
+		upper[j/2] = (lo - hi) / 2
+	}
+	copy(delay, buf[len(in):])
+}
+
+// qmfSynthesis merges a lower and upper half band into out of 2*len(lower) samples, delay holds 46 samples of state
+func qmfSynthesis(lower, upper, out, delay []float64) {
+	buf := make([]float64, 46+2*len(lower))
+	copy(buf, delay)
+	p := buf[46:]
+	for i := range lower {
+		p[2*i] = lower[i] + upper[i]
+		p[2*i+1] = lower[i] - upper[i]
+	}
+	for j := 0; j < len(lower); j++ {
+		var s1, s2 float64
+		w := buf[2*j:]
+		for i := 0; i < 48; i += 2 {
+			s1 += w[i] * qmfWindow[i]
+			s2 += w[i+1] * qmfWindow[i+1]
+		}
+		out[2*j] = s2
+		out[2*j+1] = s1
+	}
+	copy(delay, buf[2*len(lower):])
+}
+
+// mdct transforms the 2n samples of in into the n lines of out:
+// out[k] = sum in[i] * cos(pi/n * (i + 0.5 + n/2) * (k + 0.5))
+func mdct(in, out []float64) {
+	n := len(out)
+	h := n / 2
+	v := make([]float64, n)
+	// fold (a, b, c, d) into (-c_r - d, a - b_r)
+	for i := 0; i < h; i++ {
+		v[i] = -in[3*h-1-i] - in[3*h+i]
+		v[h+i] = in[i] - in[n-1-i]
+	}
+	dct4(v, out)
+}
+
+// imdct transforms the n lines of in into 2n samples of out, the inverse of mdct up to a factor n
+func imdct(in, out []float64) {
+	n := len(in)
+	h := n / 2
+	v := make([]float64, n)
+	dct4(in, v)
+	// unfold (v1, v2) into (v2, -v2_r, -v1_r, -v1)
+	for i := 0; i < h; i++ {
+		out[i] = v[h+i]
+		out[h+i] = -v[n-1-i]
+		out[n+i] = -v[h-1-i]
+		out[n+h+i] = -v[i]
+	}
+}
+
+// dct4 computes the unnormalized DCT-IV of in with a complex fft of half the length
+func dct4(in, out []float64) {
+	n := len(in)
+	h := n / 2
+	z := make([]complex128, h)
+	for i := 0; i < h; i++ {
+		z[i] = complex(in[2*i], in[n-1-2*i]) * cmplx.Exp(complex(0, -math.Pi*(float64(i)+0.25)/float64(n)))
+	}
+	fft(z)
+	for k := 0; k < h; k++ {
+		y := z[k] * cmplx.Exp(complex(0, -math.Pi*float64(k)/float64(n)))
+		out[2*k] = real(y)
+		out[n-1-2*k] = -imag(y)
+	}
+}
+
+// fft is an in place radix-2 fft, len(x) must be a power of 2
+func fft(x []complex128) {
+	n := len(x)
+	for i, j := 1, 0; i < n; i++ {
+		bit := n >> 1
+		for ; j&bit != 0; bit >>= 1 {
+			j ^= bit
+		}
+		j ^= bit
+		if i < j {
+			x[i], x[j] = x[j], x[i]
+		}
+	}
+	for size := 2; size <= n; size <<= 1 {
+		w := cmplx.Exp(complex(0, -2*math.Pi/float64(size)))
+		for start := 0; start < n; start += size {
+			t := complex(1, 0)
+			for k := 0; k < size/2; k++ {
+				a, b := x[start+k], x[start+k+size/2]*t
+				x[start+k], x[start+k+size/2] = a+b, a-b
+				t *= w
+			}
+		}
+	}
+}
+
+// bitWriter writes msb first
+type bitWriter struct {
+	buf []byte
+	n   int // bits written
+}
+
+func (w *bitWriter) write(v uint32, bits int) {
+	for i := bits - 1; i >= 0; i-- {
+		if w.n%8 == 0 {
+			w.buf = append(w.buf, 0)
+		}
+		if v>>uint(i)&1 != 0 {
+			w.buf[w.n/8] |= 0x80 >> uint(w.n%8)
+		}
+		w.n++
+	}
+}
+
+// bitReader reads msb first, reading past the end returns zero bits and sets overrun
+type bitReader struct {
+	buf     []byte
+	n       int
+	overrun bool
+}
+
+func (r *bitReader) read(bits int) uint32 {
+	var v uint32
+	for i := 0; i < bits; i++ {
+		v <<= 1
+		if r.n/8 >= len(r.buf) {
+			r.overrun = true
+		} else if r.buf[r.n/8]&(0x80>>uint(r.n%8)) != 0 {
+			v |= 1
+		}
+		r.n++
+	}
+	return v
+}
+
+// peek returns the next bits without reading them, bits past the end are zero
+func (r *bitReader) peek(bits int) uint32 {
+	n, overrun := r.n, r.overrun
+	v := r.read(bits)
+	r.n, r.overrun = n, overrun
+	return v
+}
+
+func (r *bitReader) readSigned(bits int) int {
+	v := int(r.read(bits))
+	if v >= 1<<uint(bits-1) {
+		v -= 1 << uint(bits)
+	}
+	return v
+}
@@ -0,0 +1,103 @@
+package atrac
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+	"testing"
+)
+
+// testSignal returns samples of a stereo mix of sines as little-endian 16 bit pcm
+func testSignal(samples int) ([]byte, [2][]float64) {
+	var ch [2][]float64
+	pcm := make([]byte, samples*4)
+	for c := range ch {
+		ch[c] = make([]float64, samples)
+	}
+	for i := 0; i < samples; i++ {
+		t := float64(i) / 44100
+		ch[0][i] = 8000*math.Sin(2*math.Pi*440*t) + 2000*math.Sin(2*math.Pi*3000*t)
+		ch[1][i] = 6000*math.Sin(2*math.Pi*660*t) + 1500*math.Sin(2*math.Pi*1200*t)
+		for c := range ch {
+			binary.LittleEndian.PutUint16(pcm[i*4+c*2:], uint16(int16(ch[c][i])))
+		}
+	}
+	return pcm, ch
+}
+
+func readPCM(t *testing.T, r io.Reader) [2][]float64 {
+	t.Helper()
+	pcm, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ch [2][]float64
+	for i := 0; i+3 < len(pcm); i += 4 {
+		for c := range ch {
+			ch[c] = append(ch[c], float64(int16(binary.LittleEndian.Uint16(pcm[i+c*2:]))))
+		}
+	}
+	return ch
+}
+
+// snr returns the signal to noise ratio in dB of out delayed by lag against in
+func snr(in, out []float64, lag int) float64 {
+	var signal, noise float64
+	for i := range in {
+		if i+lag >= len(out) {
+			break
+		}
+		d := out[i+lag] - in[i]
+		signal += in[i] * in[i]
+		noise += d * d
+	}
+	return 10 * math.Log10(signal/noise)
+}
+
+func TestLPRoundTrip(t *testing.T) {
+	const samples = 16 * atrac3FrameSamples
+	for _, tt := range []struct {
+		name   string
+		format Format
+		minSNR float64
+	}{
+		{"LP2", LP2, 25},
+		{"LP4", LP4, 20},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			pcm, in := testSignal(samples)
+			enc, err := NewLPEncoder(bytes.NewReader(pcm), 2, samples, tt.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			frames, err := io.ReadAll(enc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(frames) != enc.Size() || len(frames)%tt.format.FrameSize() != 0 {
+				t.Fatalf("encoded %d bytes, size %d", len(frames), enc.Size())
+			}
+			dec, err := NewLPDecoder(bytes.NewReader(frames), len(frames)/tt.format.FrameSize(), tt.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			out := readPCM(t, dec)
+
+			best, lag := math.Inf(-1), 0
+			for l := 0; l < 2*atrac3FrameSamples+400; l++ {
+				if s := snr(in[0], out[0], l); s > best {
+					best, lag = s, l
+				}
+			}
+			if lag != atrac3Delay {
+				t.Fatalf("delay %d, want %d", lag, atrac3Delay)
+			}
+			for c := range in {
+				if s := snr(in[c], out[c], atrac3Delay); s < tt.minSNR {
+					t.Fatalf("channel %d snr %.1f dB, want at least %.0f dB", c, s, tt.minSNR)
+				}
+			}
+		})
+	}
+}
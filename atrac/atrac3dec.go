@@ -0,0 +1,454 @@
+// The ATRAC3 decoder is derived from libavcodec/atrac3.c of FFmpeg,
+// Copyright (c) 2006-2008 Maxim Poliakovski and Benjamin Larsson.
+//
+// This library is free software; you can redistribute it and/or modify it under the terms of the GNU Lesser General
+// Public License as published by the Free Software Foundation; either version 2.1 of the License, or (at your option)
+// any later version.
+//
+// This library is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+// warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Lesser General Public License in the
+// LICENSE file of this directory for more details.
+
+package atrac
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// atrac3Gain holds the gain control points of one qmf band
+type atrac3Gain struct {
+	points int
+	level  [8]int
+	loc    [8]int
+}
+
+type atrac3Tonal struct {
+	pos  int
+	coef []float64
+}
+
+// atrac3Unit is the decoder state of one channel
+type atrac3Unit struct {
+	gain     [2][4]atrac3Gain // gain of the previous and current frame, swapped every frame
+	gainNow  int
+	tonals   []atrac3Tonal
+	spectrum [atrac3FrameSamples]float64
+	prev     [atrac3FrameSamples]float64 // overlap of the previous imdct
+	delay    [3][46]float64              // iqmf delays
+}
+
+// atrac3Decoder turns ATRAC3 frames into pcm, frames are 384 bytes for LP2 and 192 bytes (joint stereo) for LP4
+type atrac3Decoder struct {
+	joint     bool
+	frameSize int
+	units     [2]*atrac3Unit
+	matrix    [3][4]int // matrix selectors of the previous, current and next frame
+	weighting [6]int
+}
+
+func newATRAC3Decoder(f Format) (*atrac3Decoder, error) {
+	if err := f.valid(); err != nil {
+		return nil, err
+	}
+	d := &atrac3Decoder{
+		joint:     f == LP4,
+		frameSize: f.FrameSize(),
+		units:     [2]*atrac3Unit{{}, {}},
+	}
+	for i := range d.matrix {
+		d.matrix[i] = [4]int{3, 3, 3, 3}
+	}
+	d.weighting = [6]int{0, 7, 0, 7, 0, 7}
+	return d, nil
+}
+
+// decodeFrame decodes one frame into the 1024 samples of the left and right channel, scaled to 16 bits
+func (d *atrac3Decoder) decodeFrame(frame []byte, left, right []float64) error {
+	if len(frame) != d.frameSize {
+		return errors.New("atrac3: wrong frame size")
+	}
+	out := [2][]float64{left, right}
+
+	if d.joint {
+		br := &bitReader{buf: frame}
+		if err := d.units[0].decode(br, false); err != nil {
+			return err
+		}
+		d.units[0].synthesizeBands(out[0])
+
+		// the second sound unit is stored backwards from the end of the frame after optional 0xf8 sync bytes
+		rev := make([]byte, len(frame))
+		for i := range frame {
+			rev[i] = frame[len(frame)-1-i]
+		}
+		start := 0
+		for start < len(rev) && rev[start] == 0xf8 {
+			start++
+		}
+		br = &bitReader{buf: rev[start:]}
+		copy(d.weighting[0:4], d.weighting[2:6])
+		d.weighting[4] = int(br.read(1))
+		d.weighting[5] = int(br.read(3))
+		d.matrix[0], d.matrix[1] = d.matrix[1], d.matrix[2]
+		for i := range d.matrix[2] {
+			d.matrix[2][i] = int(br.read(2))
+		}
+		if err := d.units[1].decode(br, true); err != nil {
+			return err
+		}
+		d.units[1].synthesizeBands(out[1])
+		reverseMatrixing(out[0], out[1], d.matrix[0], d.matrix[1])
+		channelWeighting(out[0], out[1], d.weighting)
+	} else {
+		unit := d.frameSize / 2
+		for ch := range out {
+			br := &bitReader{buf: frame[ch*unit : (ch+1)*unit]}
+			if err := d.units[ch].decode(br, false); err != nil {
+				return err
+			}
+			d.units[ch].synthesizeBands(out[ch])
+		}
+	}
+
+	for ch, u := range d.units {
+		p := out[ch]
+		qmfSynthesis(p[0:256], p[256:512], p[0:512], u.delay[0][:])
+		qmfSynthesis(p[768:1024], p[512:768], p[512:1024], u.delay[1][:])
+		qmfSynthesis(p[0:512], p[512:1024], p, u.delay[2][:])
+	}
+	return nil
+}
+
+// decode reads a sound unit into the spectrum of u
+func (u *atrac3Unit) decode(br *bitReader, second bool) error {
+	if second {
+		if br.read(2) != atrac3JointUnitID {
+			return errors.New("atrac3: joint stereo sound unit id != 3")
+		}
+	} else if br.read(6) != atrac3UnitID {
+		return errors.New("atrac3: sound unit id != 0x28")
+	}
+
+	bands := int(br.read(2))
+	next := &u.gain[1-u.gainNow]
+	for b := 0; b < 4; b++ {
+		next[b].points = 0
+		if b > bands {
+			continue
+		}
+		next[b].points = int(br.read(3))
+		for j := 0; j < next[b].points; j++ {
+			next[b].level[j] = int(br.read(4))
+			next[b].loc[j] = int(br.read(5))
+			if j > 0 && next[b].loc[j] <= next[b].loc[j-1] {
+				return errors.New("atrac3: invalid gain control")
+			}
+		}
+	}
+
+	if err := u.decodeTonals(br, bands); err != nil {
+		return err
+	}
+
+	n := int(br.read(5)) + 1
+	clc := br.read(1) == 1
+	var sel, sf [atrac3Subbands]int
+	for i := 0; i < n; i++ {
+		sel[i] = int(br.read(3))
+	}
+	for i := 0; i < n; i++ {
+		if sel[i] != 0 {
+			sf[i] = int(br.read(6))
+		}
+	}
+	u.spectrum = [atrac3FrameSamples]float64{}
+	mantissas := make([]int, 128)
+	for i := 0; i < n; i++ {
+		if sel[i] == 0 {
+			continue
+		}
+		first, last := atrac3SubbandTab[i], atrac3SubbandTab[i+1]
+		readATRAC3Mantissas(br, sel[i], clc, mantissas[:last-first])
+		scale := atrac3SFTable[sf[i]] / atrac3MaxQuant[sel[i]]
+		for j := first; j < last; j++ {
+			u.spectrum[j] = float64(mantissas[j-first]) * scale
+		}
+	}
+	for _, t := range u.tonals {
+		for j, c := range t.coef {
+			u.spectrum[t.pos+j] += c
+		}
+	}
+	if br.overrun {
+		return errors.New("atrac3: sound unit exceeds the frame")
+	}
+	return nil
+}
+
+func (u *atrac3Unit) decodeTonals(br *bitReader, bands int) error {
+	u.tonals = u.tonals[:0]
+	components := int(br.read(5))
+	if components == 0 {
+		return nil
+	}
+	selector := int(br.read(2))
+	if selector == 2 {
+		return errors.New("atrac3: invalid tonal coding mode")
+	}
+	clc := selector&1 == 1
+	mantissas := make([]int, 8)
+	for i := 0; i < components; i++ {
+		var flags [4]bool
+		for b := 0; b <= bands; b++ {
+			flags[b] = br.read(1) == 1
+		}
+		values := int(br.read(3)) + 1
+		sel := int(br.read(3))
+		if sel <= 1 {
+			return errors.New("atrac3: invalid tonal quantizer")
+		}
+		if selector == 3 {
+			clc = br.read(1) == 1
+		}
+		for b := 0; b < (bands+1)*4; b++ {
+			if !flags[b/4] {
+				continue
+			}
+			coded := int(br.read(3))
+			for c := 0; c < coded; c++ {
+				if len(u.tonals) >= 64 {
+					return errors.New("atrac3: too many tonal components")
+				}
+				sf := int(br.read(6))
+				pos := b*64 + int(br.read(6))
+				n := values
+				if n > atrac3FrameSamples-pos {
+					n = atrac3FrameSamples - pos
+				}
+				readATRAC3Mantissas(br, sel, clc, mantissas[:n])
+				scale := atrac3SFTable[sf] / atrac3MaxQuant[sel]
+				t := atrac3Tonal{pos: pos, coef: make([]float64, n)}
+				for m := range t.coef {
+					t.coef[m] = float64(mantissas[m]) * scale
+				}
+				u.tonals = append(u.tonals, t)
+			}
+		}
+	}
+	return nil
+}
+
+// readATRAC3Mantissas reads len(m) quantized values of selector sel
+func readATRAC3Mantissas(br *bitReader, sel int, clc bool, m []int) {
+	if clc {
+		bits := atrac3CLCLength[sel]
+		if sel == 1 {
+			for i := 0; i < len(m); i += 2 {
+				code := br.read(bits)
+				m[i] = atrac3MantissaCLC[code>>2]
+				m[i+1] = atrac3MantissaCLC[code&3]
+			}
+			return
+		}
+		for i := range m {
+			m[i] = br.readSigned(bits)
+		}
+		return
+	}
+	for i := 0; i < len(m); i++ {
+		symbol := readHuffman(br, sel-1)
+		if sel == 1 {
+			m[i] = atrac3MantissaVLC[symbol*2]
+			m[i+1] = atrac3MantissaVLC[symbol*2+1]
+			i++
+			continue
+		}
+		v := (symbol + 1) >> 1
+		if (symbol+1)&1 != 0 {
+			v = -v
+		}
+		m[i] = v
+	}
+}
+
+// readHuffman reads one symbol of huffman table t
+func readHuffman(br *bitReader, t int) int {
+	e := atrac3HuffLookup[t][br.peek(8)]
+	br.read(int(e & 0x0f))
+	return int(e >> 4)
+}
+
+// synthesizeBands transforms the spectrum back into the 4 qmf bands of out with gain compensation and overlap
+func (u *atrac3Unit) synthesizeBands(out []float64) {
+	now, next := &u.gain[u.gainNow], &u.gain[1-u.gainNow]
+	buf := make([]float64, 512)
+	spec := make([]float64, atrac3BandSamples)
+	for band := 0; band < 4; band++ {
+		copy(spec, u.spectrum[band*256:(band+1)*256])
+		if band&1 == 1 {
+			// the odd bands are spectrally inverted by the qmf
+			for i := 0; i < 128; i++ {
+				spec[i], spec[255-i] = spec[255-i], spec[i]
+			}
+		}
+		imdct(spec, buf)
+		for i := range buf {
+			buf[i] *= atrac3MDCTWindow[i]
+		}
+		gainCompensation(buf, u.prev[band*256:(band+1)*256], &now[band], &next[band], out[band*256:(band+1)*256])
+	}
+	u.gainNow ^= 1
+}
+
+// gainCompensation overlaps the first half of in with prev applying the gain of the current and next frame,
+// the second half of in is kept in prev
+func gainCompensation(in, prev []float64, now, next *atrac3Gain, out []float64) {
+	scale := 1.0
+	if next.points > 0 {
+		scale = math.Pow(2, float64(4-next.level[0]))
+	}
+	pos := 0
+	for i := 0; i < now.points; i++ {
+		last := now.loc[i] << 3
+		lev := math.Pow(2, float64(4-now.level[i]))
+		to := 4
+		if i+1 < now.points {
+			to = now.level[i+1]
+		}
+		inc := math.Pow(2, -float64(to-now.level[i])/8)
+		for ; pos < last; pos++ {
+			out[pos] = (in[pos]*scale + prev[pos]) * lev
+		}
+		for ; pos < last+8; pos++ {
+			out[pos] = (in[pos]*scale + prev[pos]) * lev
+			lev *= inc
+		}
+	}
+	for ; pos < len(out); pos++ {
+		out[pos] = in[pos]*scale + prev[pos]
+	}
+	copy(prev, in[len(out):])
+}
+
+var atrac3MatrixCoeffs = [8]float64{0, 2, 2, 2, 0, 0, 1, 1}
+
+func interpolate(old, new float64, n int) float64 {
+	return old + float64(n)*0.125*(new-old)
+}
+
+// reverseMatrixing restores the left and right channel from the two sound units of a joint stereo frame
+func reverseMatrixing(su1, su2 []float64, prev, now [4]int) {
+	for i := 0; i < 4; i++ {
+		band := i * 256
+		s1, s2 := prev[i], now[i]
+		n := band
+		if s1 != s2 {
+			mc1l, mc1r := atrac3MatrixCoeffs[s1*2], atrac3MatrixCoeffs[s1*2+1]
+			mc2l, mc2r := atrac3MatrixCoeffs[s2*2], atrac3MatrixCoeffs[s2*2+1]
+			for ; n < band+8; n++ {
+				c1, c2 := su1[n], su2[n]
+				c2 = c1*interpolate(mc1l, mc2l, n-band) + c2*interpolate(mc1r, mc2r, n-band)
+				su1[n] = c2
+				su2[n] = c1*2 - c2
+			}
+		}
+		for ; n < band+256; n++ {
+			c1, c2 := su1[n], su2[n]
+			switch s2 {
+			case 0:
+				su1[n], su2[n] = c2*2, (c1-c2)*2
+			case 1:
+				su1[n], su2[n] = (c1+c2)*2, c2*-2
+			default:
+				su1[n], su2[n] = c1+c2, c1-c2
+			}
+		}
+	}
+}
+
+func channelWeights(index, flag int) [2]float64 {
+	if index == 7 {
+		return [2]float64{1, 1}
+	}
+	w := [2]float64{float64(index&7) / 7, 0}
+	w[1] = math.Sqrt(2 - w[0]*w[0])
+	if flag != 0 {
+		w[0], w[1] = w[1], w[0]
+	}
+	return w
+}
+
+func channelWeighting(su1, su2 []float64, p [6]int) {
+	if p[1] == 7 && p[3] == 7 {
+		return
+	}
+	w := [2][2]float64{channelWeights(p[1], p[0]), channelWeights(p[3], p[2])}
+	for band := 256; band < 1024; band += 256 {
+		n := band
+		for ; n < band+8; n++ {
+			su1[n] *= interpolate(w[0][0], w[0][1], n-band)
+			su2[n] *= interpolate(w[1][0], w[1][1], n-band)
+		}
+		for ; n < band+256; n++ {
+			su1[n] *= w[1][0]
+			su2[n] *= w[1][1]
+		}
+	}
+}
+
+// atrac3PCMReader decodes the ATRAC3 frames of src into little-endian 16 bit stereo pcm while it is read
+type atrac3PCMReader struct {
+	src    io.Reader
+	frames int
+	frame  int // frames decoded
+	dec    *atrac3Decoder
+	buf    []byte
+}
+
+func (r *atrac3PCMReader) Read(p []byte) (int, error) {
+	if len(r.buf) == 0 {
+		if r.frame == r.frames {
+			return 0, io.EOF
+		}
+		if err := r.decode(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+func (r *atrac3PCMReader) decode() error {
+	frame := make([]byte, r.dec.frameSize)
+	if _, err := io.ReadFull(r.src, frame); err != nil {
+		return err
+	}
+	left, right := make([]float64, atrac3FrameSamples), make([]float64, atrac3FrameSamples)
+	if err := r.dec.decodeFrame(frame, left, right); err != nil {
+		return fmt.Errorf("frame %d: %w", r.frame, err)
+	}
+	pcm := make([]byte, atrac3FrameSamples*4)
+	for i := range left {
+		binary.LittleEndian.PutUint16(pcm[i*4:], uint16(toInt16(left[i])))
+		binary.LittleEndian.PutUint16(pcm[i*4+2:], uint16(toInt16(right[i])))
+	}
+	r.buf = pcm
+	r.frame++
+	return nil
+}
+
+func toInt16(v float64) int16 {
+	v = math.Round(v)
+	if v > math.MaxInt16 {
+		return math.MaxInt16
+	}
+	if v < math.MinInt16 {
+		return math.MinInt16
+	}
+	return int16(v)
+}
@@ -0,0 +1,79 @@
+package atrac
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func encodeTest(t *testing.T, samples int, f Format) []byte {
+	t.Helper()
+	pcm, _ := testSignal(samples)
+	enc, err := NewLPEncoder(bytes.NewReader(pcm), 2, samples, f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	frames, err := io.ReadAll(enc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return frames
+}
+
+func TestLPDecoder(t *testing.T) {
+	valid := encodeTest(t, 4*atrac3FrameSamples, LP2)
+	frames := len(valid) / atrac3FrameSizeLP2
+
+	tests := []struct {
+		name   string
+		format Format
+		data   func() []byte
+		frames int
+		err    string
+	}{
+		{"whole stream", LP2, func() []byte { return valid }, frames, ""},
+		{"unknown format", Format(2), func() []byte { return valid }, frames, "format must be LP2 or LP4"},
+		{"corrupt first frame", LP2, func() []byte {
+			return make([]byte, atrac3FrameSizeLP2)
+		}, 1, "frame 0: atrac3: sound unit id != 0x28"},
+		{"corrupt second frame", LP2, func() []byte {
+			d := append([]byte(nil), valid...)
+			d[atrac3FrameSizeLP2] = 0
+			return d
+		}, frames, "frame 1: "},
+		{"corrupt joint stereo unit", LP4, func() []byte {
+			d := encodeTest(t, atrac3FrameSamples, LP4)
+			// the second unit is stored backwards, its id follows 12 bits of weighting and matrix selectors
+			d[atrac3FrameSizeLP4-1], d[atrac3FrameSizeLP4-2] = 0, 0
+			return d
+		}, 2, "frame 0: atrac3: joint stereo sound unit id != 3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dec, err := NewLPDecoder(bytes.NewReader(tt.data()), tt.frames, tt.format)
+			if err == nil {
+				var pcm []byte
+				pcm, err = io.ReadAll(dec)
+				if err == nil && len(pcm) != tt.frames*atrac3FrameSamples*4 {
+					t.Fatalf("decoded %d bytes, want %d", len(pcm), tt.frames*atrac3FrameSamples*4)
+				}
+			}
+			if tt.err == "" && err != nil || tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+				t.Fatalf("error %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestLPDecoderTruncated(t *testing.T) {
+	valid := encodeTest(t, atrac3FrameSamples, LP4)
+	dec, err := NewLPDecoder(bytes.NewReader(valid[:len(valid)-1]), len(valid)/atrac3FrameSizeLP4, LP4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = io.ReadAll(dec); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("truncated stream returned %v", err)
+	}
+}
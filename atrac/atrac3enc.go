@@ -0,0 +1,412 @@
+// The ATRAC3 encoder writes the bitstream read by libavcodec/atrac3.c of FFmpeg with its tables and filter bank,
+// Copyright (c) 2006-2008 Maxim Poliakovski and Benjamin Larsson.
+//
+// This library is free software; you can redistribute it and/or modify it under the terms of the GNU Lesser General
+// Public License as published by the Free Software Foundation; either version 2.1 of the License, or (at your option)
+// any later version.
+//
+// This library is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+// warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Lesser General Public License in the
+// LICENSE file of this directory for more details.
+
+package atrac
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+)
+
+// atrac3Delay is the number of samples the decoded audio lags behind the input of the encoder,
+// the qmf stages add 46 samples each (the second runs at half rate) and the mdct overlap one frame
+const atrac3Delay = atrac3FrameSamples + 46 + 2*46
+
+// atrac3Scale turns the mdct of a 16 bit signal into the spectrum scale of the decoder
+const atrac3Scale = 1.0 / 256
+
+// atrac3EncUnit is the encoder state of one channel
+type atrac3EncUnit struct {
+	delay [3][46]float64                // qmf delays
+	prev  [4][atrac3BandSamples]float64 // band samples of the previous frame for the mdct overlap
+}
+
+// atrac3Coded is a quantized spectrum ready to be written as a sound unit
+type atrac3Coded struct {
+	subbands int // coded subbands
+	sel      [atrac3Subbands]int
+	sf       [atrac3Subbands]int
+	q        [atrac3FrameSamples]int
+	clc      bool
+	bits     int
+	level    float64 // noise level it was quantized for
+}
+
+// atrac3Encoder turns 16 bit pcm into ATRAC3 frames, LP2 codes both channels in their own half of the frame,
+// LP4 codes the mid and side channel in one joint stereo frame
+type atrac3Encoder struct {
+	joint     bool
+	frameSize int
+	units     [2]*atrac3EncUnit
+}
+
+func newATRAC3Encoder(f Format) (*atrac3Encoder, error) {
+	if err := f.valid(); err != nil {
+		return nil, err
+	}
+	return &atrac3Encoder{
+		joint:     f == LP4,
+		frameSize: f.FrameSize(),
+		units:     [2]*atrac3EncUnit{{}, {}},
+	}, nil
+}
+
+// encodeFrame encodes 1024 samples of the left and right channel
+func (e *atrac3Encoder) encodeFrame(left, right []float64) []byte {
+	frame := make([]byte, e.frameSize)
+	if !e.joint {
+		unit := e.frameSize / 2
+		for ch, in := range [][]float64{left, right} {
+			spec := newATRAC3Spectrum(e.units[ch].analyze(in))
+			c := quantizeATRAC3(spec, func(c *atrac3Coded) bool {
+				return c.bits <= unit*8
+			}, false)
+			w := &bitWriter{}
+			c.write(w, false)
+			copy(frame[ch*unit:], w.buf)
+		}
+		return frame
+	}
+
+	mid, side := make([]float64, len(left)), make([]float64, len(left))
+	for i := range left {
+		mid[i] = (left[i] + right[i]) / 2
+		side[i] = (left[i] - right[i]) / 2
+	}
+	specMid, specSide := newATRAC3Spectrum(e.units[0].analyze(mid)), newATRAC3Spectrum(e.units[1].analyze(side))
+
+	// both units share the frame, so they are quantized for the same noise level
+	var side1 *atrac3Coded
+	fits := func(c *atrac3Coded) bool {
+		side1 = specSide.quantize(c.level, true)
+		return (c.bits+7)/8+(side1.bits+7)/8 <= e.frameSize
+	}
+	c1 := quantizeATRAC3(specMid, fits, false)
+	fits(c1)
+
+	w := &bitWriter{}
+	c1.write(w, false)
+	copy(frame, w.buf)
+
+	// the second unit is written backwards from the end of the frame, no channel weighting and the
+	// matrix selector 3 (left = mid + side, right = mid - side) for all bands
+	w = &bitWriter{}
+	w.write(0, 1)
+	w.write(7, 3)
+	for i := 0; i < 4; i++ {
+		w.write(3, 2)
+	}
+	side1.write(w, true)
+	for i, b := range w.buf {
+		frame[len(frame)-1-i] = b
+	}
+	return frame
+}
+
+// analyze splits the 1024 samples of in with the qmf into 4 bands and transforms them into a spectrum
+func (u *atrac3EncUnit) analyze(in []float64) []float64 {
+	lo, hi := make([]float64, 512), make([]float64, 512)
+	qmfAnalysis(in, lo, hi, u.delay[0][:])
+	var bands [4][]float64
+	for i := range bands {
+		bands[i] = make([]float64, atrac3BandSamples)
+	}
+	qmfAnalysis(lo, bands[0], bands[1], u.delay[1][:])
+	qmfAnalysis(hi, bands[3], bands[2], u.delay[2][:])
+
+	spectrum := make([]float64, atrac3FrameSamples)
+	buf := make([]float64, 512)
+	for b, band := range bands {
+		copy(buf, u.prev[b][:])
+		copy(buf[256:], band)
+		copy(u.prev[b][:], band)
+		for i := range buf {
+			buf[i] *= atrac3EncodeWindow[i]
+		}
+		spec := spectrum[b*256 : (b+1)*256]
+		mdct(buf, spec)
+		for i := range spec {
+			spec[i] *= atrac3Scale
+		}
+		if b&1 == 1 {
+			for i := 0; i < 128; i++ {
+				spec[i], spec[255-i] = spec[255-i], spec[i]
+			}
+		}
+	}
+	return spectrum
+}
+
+// atrac3Spectrum is a spectrum with the scale factor of every subband
+type atrac3Spectrum struct {
+	lines []float64
+	sf    [atrac3Subbands]int
+	zero  [atrac3Subbands]bool
+}
+
+func newATRAC3Spectrum(lines []float64) *atrac3Spectrum {
+	s := &atrac3Spectrum{lines: lines}
+	for i := 0; i < atrac3Subbands; i++ {
+		peak := 0.0
+		for _, v := range lines[atrac3SubbandTab[i]:atrac3SubbandTab[i+1]] {
+			peak = math.Max(peak, math.Abs(v))
+		}
+		for s.sf[i] < 63 && atrac3SFTable[s.sf[i]] < peak {
+			s.sf[i]++
+		}
+		s.zero[i] = peak == 0
+	}
+	return s
+}
+
+// quantizeATRAC3 searches the lowest noise level for which the coded spectrum fits
+func quantizeATRAC3(s *atrac3Spectrum, fits func(*atrac3Coded) bool, second bool) *atrac3Coded {
+	lo, hi := -24.0, 64.0
+	best := s.quantize(hi, second)
+	for i := 0; i < 20; i++ {
+		mid := (lo + hi) / 2
+		c := s.quantize(mid, second)
+		if fits(c) {
+			best, hi = c, mid
+		} else {
+			lo = mid
+		}
+	}
+	return best
+}
+
+// quantize quantizes the spectrum with a noise level (in scale factor steps of 2 dB) that is the same in every
+// subband, subbands with less energy than the noise are not coded
+func (s *atrac3Spectrum) quantize(level float64, second bool) *atrac3Coded {
+	c := &atrac3Coded{level: level}
+	last := -1
+	for i := 0; i < atrac3Subbands; i++ {
+		first, end := atrac3SubbandTab[i], atrac3SubbandTab[i+1]
+		sf := s.sf[i]
+
+		// the highest subbands are less audible and get less bits
+		penalty := 0.0
+		if i >= 28 {
+			penalty = float64(i-27) * 1.5
+		}
+		r := math.Pow(2, (float64(sf)-level-penalty)/3)
+		if r < 0.5 || s.zero[i] {
+			continue
+		}
+		sel := 1
+		for sel < 7 && atrac3MaxQuant[sel] < r {
+			sel++
+		}
+		c.sel[i], c.sf[i] = sel, sf
+		scale := atrac3MaxQuant[sel] / atrac3SFTable[sf]
+		limit := int(atrac3MaxQuant[sel])
+		for j := first; j < end; j++ {
+			q := int(math.Round(s.lines[j] * scale))
+			if q > limit {
+				q = limit
+			} else if q < -limit {
+				q = -limit
+			}
+			c.q[j] = q
+		}
+		last = i
+	}
+
+	// a decoder derives the number of transformed bands from the start of the last coded subband,
+	// so that subband may not start a band
+	c.subbands = last + 1
+	if c.subbands == 0 || atrac3SubbandTab[c.subbands-1]%atrac3BandSamples == 0 {
+		c.subbands++
+	}
+	c.count(second)
+	return c
+}
+
+// bands returns the highest qmf band that holds coded lines
+func (c *atrac3Coded) bands() int {
+	return (atrac3SubbandTab[c.subbands] - 1) / atrac3BandSamples
+}
+
+// count sets the size of the sound unit in bits and picks the smallest of constant and variable length coding
+func (c *atrac3Coded) count(second bool) {
+	bits := 6
+	if second {
+		bits = 2 + 12 // id and the weighting and matrix info in front of it
+	}
+	bits += 2 + 3*(c.bands()+1) + 5 // coded bands, no gain points, no tonal components
+	bits += 5 + 1 + 3*c.subbands
+
+	vlc, clc := 0, 0
+	for i := 0; i < c.subbands; i++ {
+		sel := c.sel[i]
+		if sel == 0 {
+			continue
+		}
+		bits += 6
+		first, end := atrac3SubbandTab[i], atrac3SubbandTab[i+1]
+		if sel == 1 {
+			clc += atrac3CLCLength[1] * (end - first) / 2
+			for j := first; j < end; j += 2 {
+				vlc += int(atrac3HuffBits[0][pairSymbol(c.q[j], c.q[j+1])])
+			}
+			continue
+		}
+		clc += atrac3CLCLength[sel] * (end - first)
+		for j := first; j < end; j++ {
+			vlc += int(atrac3HuffBits[sel-1][valueSymbol(c.q[j])])
+		}
+	}
+	c.clc = clc < vlc
+	if c.clc {
+		bits += clc
+	} else {
+		bits += vlc
+	}
+	c.bits = bits
+}
+
+// write writes the sound unit, the second unit of a joint stereo frame has a 2 bit id
+func (c *atrac3Coded) write(w *bitWriter, second bool) {
+	if second {
+		w.write(atrac3JointUnitID, 2)
+	} else {
+		w.write(atrac3UnitID, 6)
+	}
+	bands := c.bands()
+	w.write(uint32(bands), 2)
+	for b := 0; b <= bands; b++ {
+		w.write(0, 3) // no gain points
+	}
+	w.write(0, 5) // no tonal components
+
+	w.write(uint32(c.subbands-1), 5)
+	if c.clc {
+		w.write(1, 1)
+	} else {
+		w.write(0, 1)
+	}
+	for i := 0; i < c.subbands; i++ {
+		w.write(uint32(c.sel[i]), 3)
+	}
+	for i := 0; i < c.subbands; i++ {
+		if c.sel[i] != 0 {
+			w.write(uint32(c.sf[i]), 6)
+		}
+	}
+	for i := 0; i < c.subbands; i++ {
+		sel := c.sel[i]
+		if sel == 0 {
+			continue
+		}
+		first, end := atrac3SubbandTab[i], atrac3SubbandTab[i+1]
+		switch {
+		case sel == 1 && c.clc:
+			for j := first; j < end; j += 2 {
+				w.write(uint32(c.q[j]&3)<<2|uint32(c.q[j+1]&3), 4)
+			}
+		case sel == 1:
+			for j := first; j < end; j += 2 {
+				s := pairSymbol(c.q[j], c.q[j+1])
+				w.write(uint32(atrac3HuffCodes[0][s]), int(atrac3HuffBits[0][s]))
+			}
+		case c.clc:
+			bits := atrac3CLCLength[sel]
+			for j := first; j < end; j++ {
+				w.write(uint32(c.q[j])&(1<<uint(bits)-1), bits)
+			}
+		default:
+			for j := first; j < end; j++ {
+				s := valueSymbol(c.q[j])
+				w.write(uint32(atrac3HuffCodes[sel-1][s]), int(atrac3HuffBits[sel-1][s]))
+			}
+		}
+	}
+}
+
+// valueSymbol returns the huffman symbol of a quantized value, symbols alternate between positive and negative values
+func valueSymbol(v int) int {
+	if v > 0 {
+		return 2*v - 1
+	}
+	return -2 * v
+}
+
+// pairSymbol returns the selector 1 huffman symbol of a pair of values in -1..1
+func pairSymbol(a, b int) int {
+	for s := 0; s < 9; s++ {
+		if atrac3MantissaVLC[s*2] == a && atrac3MantissaVLC[s*2+1] == b {
+			return s
+		}
+	}
+	return 0
+}
+
+// atrac3Reader encodes the little-endian 16 bit pcm of src into ATRAC3 frames while it is read,
+// the input is followed by silence until the delay of the encoder is flushed
+// LPEncoder encodes pcm into ATRAC3 frames while it is read
+type LPEncoder struct {
+	src      io.Reader
+	channels int
+	samples  int // samples per channel left in src
+	frames   int // frames left to encode
+	size     int
+	enc      *atrac3Encoder
+	buf      []byte
+}
+
+// atrac3Frames returns the number of frames needed to encode samples per channel
+func atrac3Frames(samples int) int {
+	return (samples + atrac3Delay + atrac3FrameSamples - 1) / atrac3FrameSamples
+}
+
+// Size returns the number of bytes of all frames
+func (r *LPEncoder) Size() int {
+	return r.size
+}
+
+func (r *LPEncoder) Read(p []byte) (int, error) {
+	if len(r.buf) == 0 {
+		if r.frames == 0 {
+			return 0, io.EOF
+		}
+		if err := r.encode(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+func (r *LPEncoder) encode() error {
+	n := atrac3FrameSamples
+	if n > r.samples {
+		n = r.samples
+	}
+	pcm := make([]byte, n*2*r.channels)
+	if _, err := io.ReadFull(r.src, pcm); err != nil {
+		return err
+	}
+	r.samples -= n
+
+	left, right := make([]float64, atrac3FrameSamples), make([]float64, atrac3FrameSamples)
+	for i := 0; i < n; i++ {
+		left[i] = float64(int16(binary.LittleEndian.Uint16(pcm[i*2*r.channels:])))
+		right[i] = left[i]
+		if r.channels == 2 {
+			right[i] = float64(int16(binary.LittleEndian.Uint16(pcm[i*4+2:])))
+		}
+	}
+	r.buf = r.enc.encodeFrame(left, right)
+	r.frames--
+	return nil
+}
@@ -0,0 +1,65 @@
+// This library is free software; you can redistribute it and/or modify it under the terms of the GNU Lesser General
+// Public License as published by the Free Software Foundation; either version 2.1 of the License, or (at your option)
+// any later version.
+//
+// This library is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+// warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Lesser General Public License in the
+// LICENSE file of the atrac directory for more details.
+
+// Package codec registers the ATRAC codecs of the atrac package as the netmd.Codec, it is imported for its side effect:
+//
+//	import _ "github.com/enimatek-nl/go-netmd-lib/atrac/codec"
+//
+// Like the atrac package it is licensed under the LGPL 2.1 or later, netmd itself does not link it
+package codec
+
+import (
+	"fmt"
+	"io"
+
+	netmd "github.com/enimatek-nl/go-netmd-lib"
+	"github.com/enimatek-nl/go-netmd-lib/atrac"
+)
+
+func init() {
+	netmd.RegisterCodec(atracCodec{})
+}
+
+type atracCodec struct{}
+
+func (atracCodec) NewEncoder(src io.Reader, channels, samples int, df netmd.DiscFormat) (io.Reader, int, error) {
+	f, err := lpFormat(df)
+	if err != nil {
+		return nil, 0, err
+	}
+	enc, err := atrac.NewLPEncoder(src, channels, samples, f)
+	if err != nil {
+		return nil, 0, err
+	}
+	return enc, enc.Size(), nil
+}
+
+func (atracCodec) NewDecoder(src io.Reader, frames int, df netmd.DiscFormat) (io.Reader, error) {
+	switch df {
+	case netmd.DfMonoSP:
+		return atrac.NewSPDecoder(src, 1, frames)
+	case netmd.DfStereoSP:
+		return atrac.NewSPDecoder(src, 2, frames)
+	}
+	f, err := lpFormat(df)
+	if err != nil {
+		return nil, err
+	}
+	return atrac.NewLPDecoder(src, frames, f)
+}
+
+// lpFormat returns the atrac format of the ATRAC3 disc format
+func lpFormat(df netmd.DiscFormat) (atrac.Format, error) {
+	switch df {
+	case netmd.DfLP2:
+		return atrac.LP2, nil
+	case netmd.DfLP4:
+		return atrac.LP4, nil
+	}
+	return 0, fmt.Errorf("atrac3: disc format %d must be DfLP2 or DfLP4", df)
+}
@@ -0,0 +1,199 @@
+package codec_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	netmd "github.com/enimatek-nl/go-netmd-lib"
+	_ "github.com/enimatek-nl/go-netmd-lib/atrac/codec"
+)
+
+// pcmWav returns a 16 bit 44100 Hz stereo wav of a sawtooth of samples per channel
+func pcmWav(samples int) []byte {
+	data := make([]byte, samples*4)
+	for i := 0; i+1 < len(data); i += 2 {
+		binary.LittleEndian.PutUint16(data[i:], uint16(i*7))
+	}
+	h := make([]byte, 44)
+	copy(h[0:4], "RIFF")
+	binary.LittleEndian.PutUint32(h[4:8], uint32(36+len(data)))
+	copy(h[8:16], "WAVEfmt ")
+	binary.LittleEndian.PutUint32(h[16:20], 16)
+	binary.LittleEndian.PutUint16(h[20:22], 1)
+	binary.LittleEndian.PutUint16(h[22:24], 2)
+	binary.LittleEndian.PutUint32(h[24:28], 44100)
+	binary.LittleEndian.PutUint32(h[28:32], 44100*4)
+	binary.LittleEndian.PutUint16(h[32:34], 4)
+	binary.LittleEndian.PutUint16(h[34:36], 16)
+	copy(h[36:40], "data")
+	binary.LittleEndian.PutUint32(h[40:44], uint32(len(data)))
+	return append(h, data...)
+}
+
+// decode decodes file and returns the pcm data of the wav
+func decode(t *testing.T, file []byte) []byte {
+	t.Helper()
+	var out bytes.Buffer
+	if err := netmd.Decode(&out, bytes.NewReader(file), int64(len(file))); err != nil {
+		t.Fatal(err)
+	}
+	if out.Len() < 44 || binary.LittleEndian.Uint32(out.Bytes()[40:44]) != uint32(out.Len()-44) {
+		t.Fatalf("decoded a wav of %d bytes", out.Len())
+	}
+	return out.Bytes()[44:]
+}
+
+func silent(pcm []byte) bool {
+	for _, b := range pcm {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func TestSendAndDownloadLP2(t *testing.T) {
+	emu := netmd.NewEmulator()
+	md := netmd.NewNetMDWithTransport(emu, false)
+	w := pcmWav(3 * 1024)
+	trk, err := md.NewTrackFromReaderWithFormat("LP2", bytes.NewReader(w), int64(len(w)), netmd.DfLP2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = md.SendTrack(trk, nil); err != nil {
+		t.Fatal(err)
+	}
+	if emu.Tracks[0].Encoding != netmd.EncLP2 {
+		t.Fatalf("sent track encoding %#x", emu.Tracks[0].Encoding)
+	}
+
+	var wav bytes.Buffer
+	if err = md.DownloadTrack(0, &wav, nil); err != nil {
+		t.Fatal(err)
+	}
+	var raw bytes.Buffer
+	frames := emu.Tracks[0].Data
+	if err = netmd.DecodeATRAC3(&raw, bytes.NewReader(frames), int64(len(frames)), netmd.WfLP2); err != nil {
+		t.Fatal(err)
+	}
+	pcm := decode(t, wav.Bytes())
+	if !bytes.Equal(pcm, raw.Bytes()[44:]) {
+		t.Fatal("decoding the frames and the downloaded wav holding them differs")
+	}
+	if len(pcm) != len(frames)/384*1024*4 || silent(pcm) {
+		t.Fatalf("decoded %d bytes of pcm from %d bytes of frames", len(pcm), len(frames))
+	}
+}
+
+// TestSendAndDownloadReference sends the frames of the reference vectors of the atrac package (see its TestReference)
+// as they are, downloads them again and checks the downloaded wav decodes to the pcm of FFmpeg
+func TestSendAndDownloadReference(t *testing.T) {
+	names, _ := filepath.Glob(filepath.Join("..", "testdata", "*.wav"))
+	if len(names) == 0 {
+		t.Skip("no reference vectors in atrac/testdata")
+	}
+	for _, name := range names {
+		t.Run(filepath.Base(name), func(t *testing.T) {
+			format := netmd.WfLP2
+			if strings.HasPrefix(filepath.Base(name), "lp4") {
+				format = netmd.WfLP4
+			}
+			ref, err := os.ReadFile(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, err := os.ReadFile(strings.TrimSuffix(name, ".wav") + ".pcm")
+			if err != nil {
+				t.Fatal(err)
+			}
+			frames := dataChunk(t, ref)
+
+			emu := netmd.NewEmulator()
+			md := netmd.NewNetMDWithTransport(emu, false)
+			trk, err := md.NewTrackFromATRAC3("Reference", bytes.NewReader(frames), int64(len(frames)), format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err = md.SendTrack(trk, nil); err != nil {
+				t.Fatal(err)
+			}
+			var wav bytes.Buffer
+			if err = md.DownloadTrack(0, &wav, nil); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(dataChunk(t, wav.Bytes()), frames) {
+				t.Fatal("the downloaded frames differ from the sent ones")
+			}
+			got := decode(t, wav.Bytes())
+			if len(got) != len(want) {
+				t.Fatalf("decoded %d bytes of pcm, want %d", len(got), len(want))
+			}
+			var signal, noise float64
+			for i := 0; i+1 < len(want); i += 2 {
+				w := float64(int16(binary.LittleEndian.Uint16(want[i:])))
+				d := float64(int16(binary.LittleEndian.Uint16(got[i:]))) - w
+				signal += w * w
+				noise += d * d
+			}
+			if s := 10 * math.Log10(signal/noise); s < 60 {
+				t.Fatalf("decoded pcm has a snr of %.1f dB against FFmpeg", s)
+			}
+		})
+	}
+}
+
+// dataChunk returns the data chunk of the wav file
+func dataChunk(t *testing.T, wav []byte) []byte {
+	t.Helper()
+	for i := 12; i+8 <= len(wav); {
+		size := int(binary.LittleEndian.Uint32(wav[i+4:]))
+		if string(wav[i:i+4]) == "data" && i+8+size <= len(wav) {
+			return wav[i+8 : i+8+size]
+		}
+		i += 8 + size + size%2
+	}
+	t.Fatal("wav has no data chunk")
+	return nil
+}
+
+func TestDownloadSilence(t *testing.T) {
+	tests := []struct {
+		name     string
+		encoding netmd.Encoding
+		channels netmd.Channels
+	}{
+		{"sp mono", netmd.EncSP, netmd.ChanMono},
+		{"sp stereo", netmd.EncSP, netmd.ChanStereo},
+		{"lp2", netmd.EncLP2, netmd.ChanStereo},
+		{"lp4", netmd.EncLP4, netmd.ChanStereo},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			emu := netmd.NewEmulator()
+			md := netmd.NewNetMDWithTransport(emu, false)
+			emu.AddTrack("Silence", tt.encoding, tt.channels, 1)
+			var file bytes.Buffer
+			if err := md.DownloadTrack(0, &file, nil); err != nil {
+				t.Fatal(err)
+			}
+			if pcm := decode(t, file.Bytes()); len(pcm) < 44100*2 || !silent(pcm) {
+				t.Fatalf("decoded %d bytes of pcm that are not all silent", len(pcm))
+			}
+			if tt.encoding != netmd.EncSP {
+				return
+			}
+			trk, err := md.NewTrackFromReader("", bytes.NewReader(file.Bytes()), int64(file.Len()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if trk.Format != netmd.WfPCM || trk.DiscFormat != netmd.EncSP.DiscFormat(tt.channels) || trk.Title != "Silence" {
+				t.Fatalf("track of the aea %+v", trk)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package atrac
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// The reference vectors are not made by this package, so an error shared by the encoder and the decoder can not hide
+// in them. testdata/<name>.wav is an ATRAC3 wav (format 0x270) of a track downloaded from an MZ-RH1 with
+// DownloadTrack, <name> starts with lp2 or lp4 for the format of its frames, and testdata/<name>.pcm is what FFmpeg
+// decodes it to:
+//
+//	ffmpeg -i testdata/lp2.wav -f s16le -ac 2 testdata/lp2.pcm
+
+// readReference returns the ATRAC3 frames of the wav at name and the pcm FFmpeg decoded them to
+func readReference(t *testing.T, name string) (frames, pcm []byte) {
+	t.Helper()
+	wav, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pcm, err = os.ReadFile(strings.TrimSuffix(name, ".wav") + ".pcm"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 12; i+8 <= len(wav); {
+		size := int(binary.LittleEndian.Uint32(wav[i+4:]))
+		if string(wav[i:i+4]) == "data" && i+8+size <= len(wav) {
+			return wav[i+8 : i+8+size], pcm
+		}
+		i += 8 + size + size%2
+	}
+	t.Fatalf("%s has no data chunk", name)
+	return
+}
+
+func TestReference(t *testing.T) {
+	names, _ := filepath.Glob(filepath.Join("testdata", "*.wav"))
+	if len(names) == 0 {
+		t.Skip("no reference vectors in testdata")
+	}
+	for _, name := range names {
+		t.Run(filepath.Base(name), func(t *testing.T) {
+			format, minSNR := LP2, 25.0
+			if strings.HasPrefix(filepath.Base(name), "lp4") {
+				format, minSNR = LP4, 20.0
+			}
+			frames, pcm := readReference(t, name)
+			if len(frames)%format.FrameSize() != 0 || len(pcm) != len(frames)/format.FrameSize()*LPFrameSamples*4 {
+				t.Fatalf("%d bytes of frames do not match %d bytes of pcm", len(frames), len(pcm))
+			}
+			want := readPCM(t, bytes.NewReader(pcm))
+
+			// the decoder matches FFmpeg up to rounding
+			dec, err := NewLPDecoder(bytes.NewReader(frames), len(frames)/format.FrameSize(), format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := readPCM(t, dec)
+			for c := range want {
+				if s := snr(want[c], got[c], 0); len(got[c]) != len(want[c]) || s < 60 {
+					t.Fatalf("channel %d decoded to %d samples with a snr of %.1f dB", c, len(got[c]), s)
+				}
+			}
+
+			// the encoder turns the reference pcm into frames that decode (with the checked decoder) to the same pcm
+			samples := len(pcm) / 4
+			enc, err := NewLPEncoder(bytes.NewReader(pcm), 2, samples, format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			encoded, err := io.ReadAll(enc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if dec, err = NewLPDecoder(bytes.NewReader(encoded), len(encoded)/format.FrameSize(), format); err != nil {
+				t.Fatal(err)
+			}
+			got = readPCM(t, dec)
+			for c := range want {
+				if s := snr(want[c], got[c], atrac3Delay); s < minSNR {
+					t.Fatalf("channel %d of the encoded reference has a snr of %.1f dB, want at least %.0f dB", c, s, minSNR)
+				}
+			}
+		})
+	}
+}
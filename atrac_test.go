@@ -0,0 +1,99 @@
+package netmd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"strings"
+	"testing"
+)
+
+// testEA3 returns an EA3 header of an unencrypted atrac3 file with frames of frameSize bytes
+func testEA3(frameSize int) []byte {
+	h := make([]byte, omaHeaderSize)
+	copy(h, "EA3")
+	h[3], h[5] = 0x01, omaHeaderSize
+	binary.BigEndian.PutUint16(h[6:8], 0xffff)
+	params := 1<<13 | frameSize/8
+	h[33], h[34], h[35] = byte(params>>16), byte(params>>8), byte(params)
+	return h
+}
+
+func TestReadOMA(t *testing.T) {
+	tag := testID3("ea3", 3, "TIT2", "\x00Title")
+	frames := make([]byte, 4*384)
+	with := func(h []byte, edit func([]byte)) []byte {
+		h = append([]byte{}, h...)
+		edit(h)
+		return h
+	}
+	tests := []struct {
+		name       string
+		file       [][]byte
+		size       int64 // 0 for the length of the file
+		format     WireFormat
+		discFormat DiscFormat
+		title      string
+		err        string
+	}{
+		{name: "lp2", file: [][]byte{tag, testEA3(384), frames}, format: WfLP2, discFormat: DfLP2, title: "Title"},
+		{name: "lp4", file: [][]byte{tag, testEA3(192), frames}, format: WfLP4, discFormat: DfLP4, title: "Title"},
+		{name: "without ea3 tag", file: [][]byte{testEA3(384), frames}, format: WfLP2, discFormat: DfLP2},
+		{name: "encrypted", file: [][]byte{tag, with(testEA3(384), func(h []byte) { h[6], h[7] = 0x00, 0x01 }), frames}, err: "encrypted"},
+		{name: "atrac3plus", file: [][]byte{tag, with(testEA3(384), func(h []byte) { h[32] = 0x01 }), frames}, err: "codec 1 not supported"},
+		{name: "48000 Hz", file: [][]byte{tag, with(testEA3(384), func(h []byte) { h[34] &^= 0x20; h[34] |= 0x40 }), frames}, err: "sample rate"},
+		{name: "atrac3 at 66 kbps", file: [][]byte{tag, testEA3(152), frames}, err: "frame size not supported"},
+		{name: "no EA3 header", file: [][]byte{tag, make([]byte, omaHeaderSize), frames}, err: "EA3 header not found"},
+		{name: "truncated header", file: [][]byte{tag, testEA3(384)[:50]}, err: "truncated EA3 header"},
+		{name: "no audio", file: [][]byte{tag, testEA3(384)}, err: "no audio data"},
+		{name: "size unknown", file: [][]byte{tag, testEA3(384), frames}, size: -1, err: "file size unknown"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := bytes.Join(tt.file, nil)
+			size := tt.size
+			if size == 0 {
+				size = int64(len(f))
+			}
+			trk, err := readTrack("", bytes.NewReader(f), size)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("error %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if trk.Format != tt.format || trk.DiscFormat != tt.discFormat || trk.Metadata.Title != tt.title || trk.size != len(frames) {
+				t.Fatalf("track %+v with metadata %+v", trk, trk.Metadata)
+			}
+			if d, _ := io.ReadAll(trk.source); !bytes.Equal(d, frames) {
+				t.Fatalf("read %d bytes of frames", len(d))
+			}
+		})
+	}
+}
+
+func TestNewTrackFromATRAC3(t *testing.T) {
+	md := NewNetMDWithTransport(NewEmulator(), false)
+	trk, err := md.NewTrackFromATRAC3("Raw", bytes.NewReader(make([]byte, 4*192)), 4*192, WfLP4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if trk.Format != WfLP4 || trk.DiscFormat != DfLP4 || trk.Frames != 8 {
+		t.Fatalf("track %+v", trk)
+	}
+	if _, err = md.NewTrackFromATRAC3("Raw", bytes.NewReader(make([]byte, 100)), 100, WfLP2); err == nil {
+		t.Fatal("a partial frame was accepted")
+	}
+	if _, err = md.NewTrackFromATRAC3("Raw", bytes.NewReader(make([]byte, 3*96)), 3*96, WfLP4); err == nil {
+		t.Fatal("half an LP4 frame was accepted")
+	}
+	if _, err = md.NewTrackFromATRAC3("Raw", bytes.NewReader(make([]byte, 192)), 192, WfLP2); err == nil {
+		t.Fatal("half an LP2 frame was accepted")
+	}
+	if _, err = md.NewTrackFromATRAC3("Raw", bytes.NewReader(make([]byte, 384)), 384, WfPCM); err == nil {
+		t.Fatal("pcm was accepted as atrac3")
+	}
+}
@@ -0,0 +1,36 @@
+package netmd
+
+import "io"
+
+const (
+	soundUnitSize  = 212  // size of an ATRAC1 sound unit, an SP frame holds one per channel
+	spFrameSamples = 512  // samples per channel of an ATRAC1 frame
+	lpFrameSamples = 1024 // samples per channel of an ATRAC3 frame
+)
+
+// Codec encodes pcm to ATRAC3 and decodes ATRAC1 and ATRAC3 to pcm for NewTrackWithFormat, aea files and the Decode
+// functions. The codecs are derived from FFmpeg and LGPL licensed so this package does not link them, importing
+// github.com/enimatek-nl/go-netmd-lib/atrac/codec registers them
+type Codec interface {
+	// NewEncoder returns a reader of the ATRAC3 frames of df (DfLP2 or DfLP4) encoded from samples per channel of
+	// little-endian 16 bit mono or stereo pcm in src and the size of all frames
+	NewEncoder(src io.Reader, channels, samples int, df DiscFormat) (io.Reader, int, error)
+	// NewDecoder returns a reader of the little-endian 16 bit pcm decoded from frames frames of df in src, ATRAC1
+	// frames hold a sound unit per channel and ATRAC3 is always decoded to stereo
+	NewDecoder(src io.Reader, frames int, df DiscFormat) (io.Reader, error)
+}
+
+var codec Codec
+
+// RegisterCodec makes c the Codec of the library, it is meant to be called from the init of the package implementing it
+func RegisterCodec(c Codec) {
+	codec = c
+}
+
+// registeredCodec returns the registered Codec or ErrNoCodec
+func registeredCodec() (Codec, error) {
+	if codec == nil {
+		return nil, ErrNoCodec
+	}
+	return codec, nil
+}
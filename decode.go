@@ -0,0 +1,121 @@
+package netmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Decode decodes the ATRAC3 audio of a wav or oma/omg file or the ATRAC1 audio of an aea file in r (of size bytes) into a
+// 16 bit pcm wav written to w, use it to preview LP2 and LP4 audio or check that a file is not corrupt before it is sent.
+// Decoding needs the registered Codec
+func Decode(w io.Writer, r io.Reader, size int64) error {
+	magic := make([]byte, 4)
+	if _, err := io.ReadFull(r, magic); err != nil {
+		return errors.New("decode: file too short")
+	}
+	r = io.MultiReader(bytes.NewReader(magic), r)
+	if bytes.Equal(magic, aeaMagic) {
+		h, err := readAEAHeader(r)
+		if err != nil {
+			return err
+		}
+		return DecodeRaw(w, r, size-aeaHeaderSize, h.discFormat())
+	}
+
+	trk, err := readTrack("", r, size)
+	if err != nil {
+		return err
+	}
+	if trk.Format == WfPCM {
+		return errors.New("decode: file holds pcm audio, nothing to decode")
+	}
+	return DecodeATRAC3(w, trk.source, int64(trk.size), trk.Format)
+}
+
+// DecodeRaw decodes the audio of a track as it is stored on the disc, ATRAC1 sound units for SP and ATRAC3 frames
+// for LP2 and LP4, from r (of size bytes) into a 16 bit pcm wav written to w with the registered Codec
+func DecodeRaw(w io.Writer, r io.Reader, size int64, df DiscFormat) error {
+	channels := 2
+	switch df {
+	case DfLP2:
+		return DecodeATRAC3(w, r, size, WfLP2)
+	case DfLP4:
+		return DecodeATRAC3(w, r, size, WfLP4)
+	case DfMonoSP:
+		channels = 1
+	case DfStereoSP:
+	default:
+		return fmt.Errorf("decode: unknown disc format %d", df)
+	}
+
+	c, err := registeredCodec()
+	if err != nil {
+		return err
+	}
+	group := int64(soundUnitSize * channels)
+	if size < 0 || size%group != 0 {
+		return fmt.Errorf("atrac1: stream size %d is not a multiple of the %d bytes sound group", size, group)
+	}
+	frames := int(size / group)
+	src, err := c.NewDecoder(r, frames, df)
+	if err != nil {
+		return err
+	}
+	h := &wavHeader{
+		format:        waveFormatPCM,
+		channels:      channels,
+		sampleRate:    44100,
+		byteRate:      44100 * 2 * channels,
+		blockAlign:    2 * channels,
+		bitsPerSample: 16,
+		dataSize:      int64(frames) * spFrameSamples * 2 * int64(channels),
+	}
+	if err = h.write(w, nil); err != nil {
+		return err
+	}
+	_, err = io.Copy(w, src)
+	return err
+}
+
+// DecodeATRAC3 decodes the headerless ATRAC3 frames of format WfLP2 or WfLP4 in r (of size bytes) into a 16 bit stereo pcm wav
+// written to w with the registered Codec, the error of a corrupt frame holds its position
+func DecodeATRAC3(w io.Writer, r io.Reader, size int64, format WireFormat) error {
+	df := DfLP2
+	switch format {
+	case WfLP2:
+	case WfLP4:
+		df = DfLP4
+	default:
+		return errors.New("atrac3: format must be WfLP2 or WfLP4")
+	}
+	c, err := registeredCodec()
+	if err != nil {
+		return err
+	}
+	frameSize := 2 * FrameSize[format]
+	if size < 0 || size%int64(frameSize) != 0 {
+		return fmt.Errorf("atrac3: stream size %d is not a multiple of the %d bytes frame size", size, frameSize)
+	}
+	frames := int(size) / frameSize
+	src, err := c.NewDecoder(r, frames, df)
+	if err != nil {
+		return err
+	}
+
+	h := &wavHeader{
+		format:        waveFormatPCM,
+		channels:      2,
+		sampleRate:    44100,
+		byteRate:      44100 * 4,
+		blockAlign:    4,
+		bitsPerSample: 16,
+		dataSize:      int64(frames) * lpFrameSamples * 4,
+	}
+	if err = h.write(w, nil); err != nil {
+		return err
+	}
+	_, err = io.Copy(w, src)
+	return err
+}
@@ -0,0 +1,131 @@
+package netmd
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+// testCodec is a Codec that encodes pcm to empty frames and decodes every frame to silence
+type testCodec struct{}
+
+func (testCodec) NewEncoder(src io.Reader, channels, samples int, df DiscFormat) (io.Reader, int, error) {
+	frameSize := 2 * FrameSize[WfLP2]
+	if df == DfLP4 {
+		frameSize = 2 * FrameSize[WfLP4]
+	}
+	size := (samples + lpFrameSamples - 1) / lpFrameSamples * frameSize
+	return io.MultiReader(&discardReader{r: src}, bytes.NewReader(make([]byte, size))), size, nil
+}
+
+func (testCodec) NewDecoder(src io.Reader, frames int, df DiscFormat) (io.Reader, error) {
+	pcm := frames * lpFrameSamples * 4
+	switch df {
+	case DfMonoSP:
+		pcm = frames * spFrameSamples * 2
+	case DfStereoSP:
+		pcm = frames * spFrameSamples * 4
+	}
+	return io.MultiReader(&discardReader{r: src}, bytes.NewReader(make([]byte, pcm))), nil
+}
+
+// discardReader reads r until its end without returning any data
+type discardReader struct {
+	r io.Reader
+}
+
+func (d *discardReader) Read(p []byte) (int, error) {
+	_, err := io.Copy(io.Discard, d.r)
+	if err == nil {
+		err = io.EOF
+	}
+	return 0, err
+}
+
+// withCodec registers c until the end of the test
+func withCodec(t *testing.T, c Codec) {
+	prev := codec
+	RegisterCodec(c)
+	t.Cleanup(func() { RegisterCodec(prev) })
+}
+
+func TestDecode(t *testing.T) {
+	frames := make([]byte, 3*192)
+	var wav bytes.Buffer
+	if err := writeATRAC3Wav(&wav, bytes.NewReader(frames), int64(len(frames)), WfLP4); err != nil {
+		t.Fatal(err)
+	}
+	var aea bytes.Buffer
+	if err := WriteAEA(&aea, "SP", 1, bytes.NewReader(make([]byte, 2*soundUnitSize)), 2*soundUnitSize); err != nil {
+		t.Fatal(err)
+	}
+
+	withCodec(t, nil)
+	if err := Decode(io.Discard, bytes.NewReader(wav.Bytes()), int64(wav.Len())); !errors.Is(err, ErrNoCodec) {
+		t.Fatalf("decoding without a codec returned %v", err)
+	}
+
+	withCodec(t, testCodec{})
+	tests := []struct {
+		name     string
+		file     []byte
+		channels int
+		data     int64
+	}{
+		{"atrac3 wav", wav.Bytes(), 2, 3 * lpFrameSamples * 4},
+		{"aea", aea.Bytes(), 1, 2 * spFrameSamples * 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := Decode(&out, bytes.NewReader(tt.file), int64(len(tt.file))); err != nil {
+				t.Fatal(err)
+			}
+			h, err := readWavHeader(&out, int64(out.Len()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if h.format != waveFormatPCM || h.channels != tt.channels || h.dataSize != tt.data || int64(out.Len()) != tt.data {
+				t.Fatalf("decoded wav %+v with %d bytes of data, want %d", h, out.Len(), tt.data)
+			}
+		})
+	}
+
+	if err := DecodeATRAC3(io.Discard, bytes.NewReader(frames), int64(len(frames)-1), WfLP4); err == nil {
+		t.Fatal("decoding a partial frame succeeded")
+	}
+	if err := DecodeATRAC3(io.Discard, bytes.NewReader(frames), int64(len(frames)), WfPCM); err == nil {
+		t.Fatal("decoding pcm as atrac3 succeeded")
+	}
+	pcm := testWav(2, 1)
+	if err := Decode(io.Discard, bytes.NewReader(pcm), int64(len(pcm))); err == nil || !strings.Contains(err.Error(), "pcm") {
+		t.Fatalf("decoding pcm returned %v", err)
+	}
+}
+
+func TestNewTrackWithFormat(t *testing.T) {
+	md := NewNetMDWithTransport(NewEmulator(), false)
+	w := testWav(2, 1)
+
+	withCodec(t, nil)
+	if _, err := md.NewTrackFromReaderWithFormat("LP2", bytes.NewReader(w), int64(len(w)), DfLP2); !errors.Is(err, ErrNoCodec) {
+		t.Fatalf("encoding without a codec returned %v", err)
+	}
+	if trk, err := md.NewTrackFromReaderWithFormat("SP", bytes.NewReader(w), int64(len(w)), DfStereoSP); err != nil || trk.Format != WfPCM {
+		t.Fatalf("pcm without a codec returned %+v, %v", trk, err)
+	}
+
+	withCodec(t, testCodec{})
+	trk, err := md.NewTrackFromReaderWithFormat("LP2", bytes.NewReader(w), int64(len(w)), DfLP2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if trk.Format != WfLP2 || trk.DiscFormat != DfLP2 || trk.size != (44100+lpFrameSamples-1)/lpFrameSamples*384 {
+		t.Fatalf("track %+v", trk)
+	}
+	if _, err = md.NewTrackFromReaderWithFormat("SP", bytes.NewReader(w), int64(len(w)), DfMonoSP); err == nil {
+		t.Fatal("stereo pcm was encoded to mono SP")
+	}
+}
@@ -0,0 +1,181 @@
+package netmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// Disc is a snapshot of the inserted disc as returned by ReadDisc, tracks are counted from 0 everywhere. Root is the
+// parsed header as it is stored on the disc (its Groups count tracks from 1) and HeaderError the malformed group that
+// was left out of it, neither is part of the json
+type Disc struct {
+	Title       string      `json:"title"`
+	Groups      []DiscGroup `json:"groups"`
+	Capacity    Capacity    `json:"capacity"`
+	Tracks      []TrackInfo `json:"tracks"`
+	Root        *Root       `json:"-"`
+	HeaderError error       `json:"-"`
+}
+
+// DiscGroup is a Group of the disc with the First and Last track starting from 0
+type DiscGroup struct {
+	Title string `json:"title"`
+	First int    `json:"first"`
+	Last  int    `json:"last"`
+}
+
+// Capacity holds the totals of the disc in seconds
+type Capacity struct {
+	Recorded  uint64 `json:"recorded"`
+	Total     uint64 `json:"total"`
+	Available uint64 `json:"available"`
+}
+
+// TrackInfo describes a single track of the disc, Index starts from 0 and Duration is in seconds. Group is the index
+// in Disc.Groups of the group the track belongs to or -1
+type TrackInfo struct {
+	Index     int      `json:"index"`
+	Title     string   `json:"title"`
+	Duration  uint64   `json:"duration"`
+	Encoding  Encoding `json:"encoding"`
+	Channels  Channels `json:"channels"`
+	Protected bool     `json:"protected"`
+	Group     int      `json:"group"`
+}
+
+// ReadDisc reads the header, capacity and every track of the inserted disc into a Disc, a malformed group in the header
+// is skipped like NewRoot does and reported in HeaderError
+func (md *NetMD) ReadDisc() (*Disc, error) {
+	return md.ReadDiscContext(context.Background())
+}
+
+// ReadDiscContext is ReadDisc with a ctx to cancel the call or set a deadline
+func (md *NetMD) ReadDiscContext(ctx context.Context) (*Disc, error) {
+	header, err := md.RequestDiscHeaderContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("read disc: requesting the header failed: %w", err)
+	}
+	d := &Disc{Groups: []DiscGroup{}}
+	d.Root, d.HeaderError = parseRoot(header)
+	d.Title = d.Root.Title
+	for _, g := range d.Root.Groups {
+		d.Groups = append(d.Groups, DiscGroup{Title: g.Title, First: g.Start - 1, Last: g.End - 1})
+	}
+
+	c := &d.Capacity
+	if c.Recorded, c.Total, c.Available, err = md.RequestDiscCapacityContext(ctx); err != nil {
+		return nil, fmt.Errorf("read disc: requesting the capacity failed: %w", err)
+	}
+
+	count, err := md.RequestTrackCountContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("read disc: requesting the track count failed: %w", err)
+	}
+	d.Tracks = make([]TrackInfo, count)
+	for trk := 0; trk < count; trk++ {
+		if d.Tracks[trk], err = md.readTrackInfo(ctx, trk); err != nil {
+			return nil, fmt.Errorf("read disc: track %d: %w", trk, err)
+		}
+		d.Tracks[trk].Group = -1
+		for i, g := range d.Groups {
+			if trk >= g.First && trk <= g.Last {
+				d.Tracks[trk].Group = i
+				break
+			}
+		}
+	}
+	return d, nil
+}
+
+// readTrackInfo requests the title, length, encoding and flag of trk, devices that do not know the flag have no
+// protected tracks
+func (md *NetMD) readTrackInfo(ctx context.Context, trk int) (t TrackInfo, err error) {
+	t.Index = trk
+	if t.Title, err = md.RequestTrackTitleContext(ctx, trk); err != nil {
+		return
+	}
+	if t.Duration, err = md.RequestTrackLengthContext(ctx, trk); err != nil {
+		return
+	}
+	if t.Encoding, t.Channels, err = md.requestTrackEncoding(ctx, trk); err != nil {
+		return
+	}
+	flag, err := md.RequestTrackFlagContext(ctx, trk)
+	if errors.Is(err, ErrNotImplemented) || errors.Is(err, ErrRejected) {
+		return t, nil
+	}
+	t.Protected = flag == TrackProtected
+	return
+}
+
+// MarshalText returns the name of the Encoding, eg. "lp2", or the hex value (eg. "0x91") of an unknown Encoding
+func (e Encoding) MarshalText() ([]byte, error) {
+	switch e {
+	case EncSP:
+		return []byte("sp"), nil
+	case EncLP2:
+		return []byte("lp2"), nil
+	case EncLP4:
+		return []byte("lp4"), nil
+	}
+	return []byte(fmt.Sprintf("0x%02x", byte(e))), nil
+}
+
+// UnmarshalText parses a name or hex value returned by MarshalText
+func (e *Encoding) UnmarshalText(b []byte) error {
+	switch string(b) {
+	case "sp":
+		*e = EncSP
+	case "lp2":
+		*e = EncLP2
+	case "lp4":
+		*e = EncLP4
+	default:
+		v, err := parseHexByte(b)
+		if err != nil {
+			return fmt.Errorf("unknown encoding %q", b)
+		}
+		*e = Encoding(v)
+	}
+	return nil
+}
+
+// MarshalText returns the name of the Channels, "stereo" or "mono", or the hex value of unknown Channels
+func (c Channels) MarshalText() ([]byte, error) {
+	switch c {
+	case ChanStereo:
+		return []byte("stereo"), nil
+	case ChanMono:
+		return []byte("mono"), nil
+	}
+	return []byte(fmt.Sprintf("0x%02x", byte(c))), nil
+}
+
+// UnmarshalText parses a name or hex value returned by MarshalText
+func (c *Channels) UnmarshalText(b []byte) error {
+	switch string(b) {
+	case "stereo":
+		*c = ChanStereo
+	case "mono":
+		*c = ChanMono
+	default:
+		v, err := parseHexByte(b)
+		if err != nil {
+			return fmt.Errorf("unknown channels %q", b)
+		}
+		*c = Channels(v)
+	}
+	return nil
+}
+
+// parseHexByte parses a byte written as 0x followed by hex digits
+func parseHexByte(b []byte) (byte, error) {
+	if !bytes.HasPrefix(b, []byte("0x")) {
+		return 0, errors.New("missing 0x prefix")
+	}
+	v, err := strconv.ParseUint(string(b[2:]), 16, 8)
+	return byte(v), err
+}
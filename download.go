@@ -0,0 +1,164 @@
+package netmd
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+)
+
+// bulkChunkSize is the largest read from the bulk in endpoint
+const bulkChunkSize = 0x10000
+
+// DownloadTrack uploads the audio of trk starting from 0 from the disc and writes it to w, SP tracks are written as
+// an ATRAC1 .aea file and LP2/LP4 tracks as an ATRAC3 wav, the optional progress func receives TtReceive Transfer's.
+// Only the Sony MZ-RH1 supports this, other devices reject the command
+func (md *NetMD) DownloadTrack(trk int, w io.Writer, progress func(Transfer)) error {
+	return md.DownloadTrackContext(context.Background(), trk, w, progress)
+}
+
+// DownloadTrackContext is DownloadTrack with a ctx to cancel the call or set a deadline, when ctx is done the bulk reads
+// are stopped and the secure session is torn down
+func (md *NetMD) DownloadTrackContext(ctx context.Context, trk int, w io.Writer, progress func(Transfer)) error {
+	notify := func(t Transfer) {
+		if progress != nil {
+			t.Track = trk
+			progress(t)
+		}
+	}
+
+	title, err := md.RequestTrackTitleContext(ctx, trk)
+	if err != nil {
+		return fmt.Errorf("download: requesting track title failed: %w", err)
+	}
+
+	if err = md.lockSession(ctx); err != nil {
+		return fmt.Errorf("download: %w", err)
+	}
+	defer md.unlockSession()
+
+	// housekeeping
+	if err = md.leaveSecureSession(ctx); err != nil {
+		return fmt.Errorf("download: leaving the secure session failed: %w", err)
+	}
+	if err = md.acquire(ctx); err != nil {
+		return fmt.Errorf("download: acquiring the device failed: %w", err)
+	}
+
+	notify(Transfer{
+		Type:  TtSetup,
+		Stage: StageSetup,
+	})
+
+	defer md.teardown()
+	if err = md.enterSecureSession(ctx); err != nil {
+		return fmt.Errorf("download: entering the secure session failed: %w", err)
+	}
+
+	df, size, err := md.startSecureRecv(ctx, trk)
+	if err != nil {
+		return fmt.Errorf("download: starting the upload failed: %w", err)
+	}
+	if md.debug {
+		log.Printf("track %d upload started: disc format %d, %d bytes", trk, df, size)
+	}
+
+	r := &bulkReader{ctx: ctx, transport: md.transport, left: size, notify: notify}
+	notify(Transfer{
+		Type:  TtReceive,
+		Stage: StageTransfer,
+	})
+
+	switch df {
+	case DfStereoSP:
+		err = WriteAEA(w, title, 2, r, int64(size))
+	case DfMonoSP:
+		err = WriteAEA(w, title, 1, r, int64(size))
+	case DfLP2:
+		err = writeATRAC3Wav(w, r, int64(size), WfLP2)
+	case DfLP4:
+		err = writeATRAC3Wav(w, r, int64(size), WfLP4)
+	default:
+		err = fmt.Errorf("unknown disc format %d", df)
+	}
+	if err != nil {
+		return fmt.Errorf("download: %w", err)
+	}
+
+	if err = md.finishSecureRecv(ctx); err != nil {
+		return fmt.Errorf("download: upload never finished: %w", err)
+	}
+	return nil
+}
+
+// writeATRAC3Wav writes the ATRAC3 frames in r (of size bytes) as a wav with the atrac3 format tag to w
+func writeATRAC3Wav(w io.Writer, r io.Reader, size int64, format WireFormat) error {
+	frameSize := 2 * FrameSize[format]
+	if size%int64(frameSize) != 0 {
+		return fmt.Errorf("atrac3: stream size %d is not a multiple of the %d bytes frame size", size, frameSize)
+	}
+
+	// the extra format bytes hold the samples per frame of both channels and the joint stereo mode used by LP4
+	jointStereo := uint16(0)
+	if format == WfLP4 {
+		jointStereo = 1
+	}
+	extra := make([]byte, 14)
+	binary.LittleEndian.PutUint16(extra[0:2], 1)
+	binary.LittleEndian.PutUint32(extra[2:6], lpFrameSamples*2)
+	binary.LittleEndian.PutUint16(extra[6:8], jointStereo)
+	binary.LittleEndian.PutUint16(extra[8:10], jointStereo)
+	binary.LittleEndian.PutUint16(extra[10:12], 1)
+
+	h := &wavHeader{
+		format:     waveFormatATRAC3,
+		channels:   2,
+		sampleRate: 44100,
+		byteRate:   44100 * frameSize / lpFrameSamples,
+		blockAlign: frameSize,
+		dataSize:   size,
+	}
+	if err := h.write(w, extra); err != nil {
+		return err
+	}
+	_, err := io.CopyN(w, r, size)
+	return err
+}
+
+// bulkReader reads the left bytes from the bulk in endpoint of transport and reports the progress to notify
+type bulkReader struct {
+	ctx       context.Context
+	transport Transport
+	left      int
+	received  int
+	notify    func(Transfer)
+}
+
+func (r *bulkReader) Read(p []byte) (int, error) {
+	if r.left == 0 {
+		return 0, io.EOF
+	}
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	if len(p) > r.left {
+		p = p[:r.left]
+	}
+	if len(p) > bulkChunkSize {
+		p = p[:bulkChunkSize]
+	}
+	n, err := r.transport.BulkIn(p)
+	r.left -= n
+	r.received += n
+	r.notify(Transfer{
+		Type:        TtReceive,
+		Stage:       StageTransfer,
+		Transferred: r.received,
+	})
+	if err == nil && n == 0 {
+		err = errors.New("bulk in returned no data")
+	}
+	return n, err
+}
@@ -0,0 +1,47 @@
+package netmd
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+// failingTransport fails every command that starts with prefix
+type failingTransport struct {
+	Transport
+	prefix []byte
+}
+
+var errTransport = errors.New("transport failed")
+
+func (f *failingTransport) ControlOut(request uint8, data []byte) (int, error) {
+	if bytes.HasPrefix(data, f.prefix) {
+		return 0, errTransport
+	}
+	return f.Transport.ControlOut(request, data)
+}
+
+func TestDownloadHandshake(t *testing.T) {
+	tests := []struct {
+		name   string
+		prefix []byte
+		err    string
+	}{
+		{"leave", []byte{0x00, 0x18, 0x00, 0x08, 0x00, 0x46, 0xf0, 0x03, 0x01, 0x03, 0x81}, "leaving the secure session failed"},
+		{"acquire", []byte{0x00, 0xff, 0x01, 0x0c}, "acquiring the device failed"},
+		{"enter", []byte{0x00, 0x18, 0x00, 0x08, 0x00, 0x46, 0xf0, 0x03, 0x01, 0x03, 0x80}, "entering the secure session failed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			emu := NewEmulator()
+			emu.AddTrack("SP", EncSP, ChanStereo, 1)
+			md := NewNetMDWithTransport(&failingTransport{Transport: emu, prefix: tt.prefix}, false)
+			err := md.DownloadTrack(0, io.Discard, nil)
+			if !errors.Is(err, errTransport) || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("download returned %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
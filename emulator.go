@@ -0,0 +1,733 @@
+package netmd
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/des"
+	"errors"
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Emulator is an in-process software NetMD that speaks the vendor control protocol, it can be used as Transport
+// with NewNetMDWithTransport to develop and test without a real device attached
+type Emulator struct {
+	Debug          bool
+	Discard        bool   // do not keep the decrypted audio data of sent tracks
+	Present        bool   // a disc is inserted
+	Busy           bool   // the device is reading the TOC
+	WriteProtected bool   // the write protect tab of the disc is set, every edit is rejected
+	Header         string // raw disc title including the groups
+	Capacity       uint64 // total capacity of the disc in seconds
+	RecEncoding    Encoding
+	RecChannels    Channels
+	Tracks         []*EmulatedTrack
+
+	mu      sync.Mutex
+	pending []byte
+	secure  bool
+	ekb     *EKB
+	kek     []byte
+	send    *emulatedSend
+	upload  *emulatedUpload
+	action  playbackAction // 0 when stopped
+	current int            // track the playback is at
+	elapsed int            // sound groups played of the current track until since
+	since   time.Time
+}
+
+// EmulatedTrack is a track on the virtual disc of the Emulator
+type EmulatedTrack struct {
+	Title    string
+	Encoding Encoding
+	Channels Channels
+	Flag     TrackProt
+	Format   WireFormat
+	Frames   int
+	Data     []byte // decrypted wire data received through Send
+}
+
+type emulatedSend struct {
+	format     WireFormat
+	discFormat DiscFormat
+	frames     int
+	totalBytes int
+	received   int
+	pending    []byte // bytes not yet decrypted, the header or an incomplete block
+	decrypter  cipher.BlockMode
+	data       []byte // decrypted audio data
+}
+
+type emulatedUpload struct {
+	check []byte
+	trk   []byte
+	data  []byte // disc data not yet read from the bulk in endpoint
+}
+
+// NewEmulator returns an Emulator with an empty 80 minute disc inserted
+func NewEmulator() *Emulator {
+	return &Emulator{
+		Present:     true,
+		Capacity:    80 * 60,
+		RecEncoding: EncSP,
+		RecChannels: ChanStereo,
+		ekb:         NewEKB(),
+	}
+}
+
+// AddTrack appends a track with a duration in seconds but without audio data to the virtual disc
+func (e *Emulator) AddTrack(title string, encoding Encoding, channels Channels, duration uint64) *EmulatedTrack {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	t := &EmulatedTrack{
+		Title:    title,
+		Encoding: encoding,
+		Channels: channels,
+		Flag:     TrackUnprotected,
+		Format:   encodingToWireFormat(encoding),
+		Frames:   secondsToFrames(duration),
+	}
+	e.Tracks = append(e.Tracks, t)
+	return t
+}
+
+// Duration returns the length of the track in seconds
+func (t *EmulatedTrack) Duration() uint64 {
+	return uint64(t.Frames) * 512 / 44100
+}
+
+func (e *Emulator) ControlOut(request uint8, data []byte) (int, error) {
+	if request != 0x80 {
+		return 0, errors.New("emulator: unknown control out request")
+	}
+	if len(data) < 2 {
+		return 0, errors.New("emulator: command too short")
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.Debug {
+		log.Printf("emulator <- % x", data)
+	}
+	e.pending = e.handle(data[1:])
+	return len(data), nil
+}
+
+func (e *Emulator) ControlIn(request uint8, data []byte) (int, error) {
+	if request != 0x81 {
+		return 0, errors.New("emulator: unknown control in request")
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.pending == nil {
+		return 0, errors.New("emulator: no response pending")
+	}
+	c := copy(data, e.pending)
+	if e.Debug {
+		log.Printf("emulator -> % x", e.pending)
+	}
+	e.pending = nil
+	return c, nil
+}
+
+func (e *Emulator) Poll(data []byte) (int, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	s := []byte{0x00, 0x00, 0x00, 0x00}
+	if e.pending != nil {
+		s = []byte{0x01, 0x81, byte(len(e.pending)) & 0xff, 0x00}
+	}
+	return copy(data, s), nil
+}
+
+func (e *Emulator) BulkOut(data []byte) (int, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.send == nil {
+		return 0, errors.New("emulator: no secure send in progress")
+	}
+	if err := e.receiveSend(data); err != nil {
+		return 0, err
+	}
+	if e.send.received >= e.send.totalBytes {
+		trk, err := e.finishSend()
+		if err != nil {
+			return 0, err
+		}
+		check := []byte{0x18, 0x00, 0x08, 0x00, 0x46, 0xf0, 0x03, 0x01, 0x03, 0x28}
+		body := []byte{0x00, 0x00, 0x01, 0x00, 0x10, 0x01}
+		body = append(body, intToHex16(int16(trk))...)
+		body = append(body, byte(e.send.format)&0xff, byte(e.send.discFormat)&0xff)
+		body = append(body, intToHex32(int32(e.send.frames))...)
+		e.pending = emulatorResponse(ControlAccepted, check, body)
+		e.send = nil
+	}
+	return len(data), nil
+}
+
+func (e *Emulator) BulkIn(data []byte) (int, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.upload == nil {
+		return 0, errors.New("emulator: no secure upload in progress")
+	}
+	c := copy(data, e.upload.data)
+	e.upload.data = e.upload.data[c:]
+	if len(e.upload.data) == 0 {
+		body := []byte{0x00, 0x00, 0x10, 0x01}
+		body = append(body, e.upload.trk...)
+		body = append(body, 0x00, 0x00)
+		e.pending = emulatorResponse(ControlAccepted, e.upload.check, body)
+		e.upload = nil
+	}
+	return c, nil
+}
+
+func (e *Emulator) Close() error {
+	return nil
+}
+
+// handle processes a single command (without the leading 0x00) and returns the response
+func (e *Emulator) handle(cmd []byte) []byte {
+	switch {
+	case bytes.HasPrefix(cmd, []byte{0x18, 0x00, 0x08, 0x00, 0x46, 0xf0, 0x03, 0x01, 0x03}) && len(cmd) > 9:
+		return e.handleSecure(cmd[:10], cmd[10:])
+	case bytes.HasPrefix(cmd, []byte{0xff, 0x01}):
+		return emulatorResponse(ControlAccepted, cmd[:2], cmd[2:]) // acquire and release
+	case bytes.HasPrefix(cmd, []byte{0x18, 0x08, 0x10}) && len(cmd) >= 6:
+		return emulatorResponse(ControlAccepted, cmd[:6], cmd[6:]) // open and close descriptors
+	case bytes.HasPrefix(cmd, []byte{0x18, 0x06, 0x02, 0x10, 0x10, 0x00}):
+		return e.discCapacity(cmd[:6])
+	case bytes.HasPrefix(cmd, []byte{0x18, 0x06, 0x01, 0x10, 0x10, 0x00}):
+		return e.discFlags(cmd[:6])
+	case bytes.HasPrefix(cmd, []byte{0x18, 0x06, 0x02, 0x10, 0x10, 0x01}):
+		return e.trackCount(cmd[:6])
+	case bytes.HasPrefix(cmd, []byte{0x18, 0x06, 0x02, 0x20, 0x18, 0x01}):
+		return e.titleResponse(cmd[:6], []byte{0x00, 0x00}, e.Header)
+	case bytes.HasPrefix(cmd, []byte{0x18, 0x06, 0x02, 0x20, 0x18, 0x02}) && len(cmd) >= 8:
+		t, ok := e.track(cmd[6:8])
+		if !ok {
+			return emulatorResponse(ControlRejected, cmd[:6], cmd[6:])
+		}
+		return e.titleResponse(cmd[:6], cmd[6:8], t.Title)
+	case bytes.HasPrefix(cmd, []byte{0x18, 0x07, 0x02, 0x20, 0x18, 0x01}) && len(cmd) >= 20:
+		if !e.edit() {
+			return emulatorResponse(ControlRejected, cmd[:6], cmd[6:])
+		}
+		e.Header = string(cmd[20:])
+		return emulatorResponse(ControlAccepted, cmd[:6], cmd[6:20])
+	case bytes.HasPrefix(cmd, []byte{0x18, 0x07, 0x02, 0x20, 0x18, 0x02}) && len(cmd) >= 20:
+		t, ok := e.track(cmd[6:8])
+		if !ok || !e.edit() {
+			return emulatorResponse(ControlRejected, cmd[:6], cmd[6:])
+		}
+		t.Title = string(cmd[20:])
+		return emulatorResponse(ControlAccepted, cmd[:6], cmd[6:20])
+	case bytes.HasPrefix(cmd, []byte{0x18, 0x06, 0x02, 0x20, 0x10, 0x01}) && len(cmd) >= 10 && cmd[9] == 0x80:
+		return e.trackEncoding(cmd[:6], cmd[6:8])
+	case bytes.HasPrefix(cmd, []byte{0x18, 0x06, 0x01, 0x20, 0x10, 0x01}) && len(cmd) >= 8:
+		return e.trackFlag(cmd[:2], cmd[2:8])
+	case bytes.HasPrefix(cmd, []byte{0x18, 0x06, 0x02, 0x20, 0x10, 0x01}) && len(cmd) >= 8:
+		return e.trackFlag(cmd[:2], cmd[2:8])
+	case bytes.HasPrefix(cmd, []byte{0x18, 0x09, 0x80, 0x01, 0x03, 0x30, 0x88, 0x02}) && len(cmd) >= 16:
+		return e.operatingStatus(cmd[:6], cmd[6:16])
+	case bytes.HasPrefix(cmd, []byte{0x18, 0x09, 0x80, 0x01, 0x03, 0x30}):
+		return e.recordingParameters(cmd[:6])
+	case bytes.HasPrefix(cmd, []byte{0x18, 0x09, 0x80, 0x01, 0x02, 0x30}):
+		return e.status(cmd[:6])
+	case bytes.Equal(cmd, []byte{0x18, 0x40, 0xff, 0x00, 0x00}):
+		return e.eraseDisc(cmd[:2], cmd[2:])
+	case bytes.Equal(cmd, []byte{0x18, 0xc1, 0xff, 0x60, 0x00}):
+		if !e.Present {
+			return emulatorResponse(ControlRejected, cmd[:2], cmd[2:])
+		}
+		e.Present = false
+		e.action = 0
+		e.seek(0, 0)
+		return emulatorResponse(ControlAccepted, cmd[:2], []byte{0x00, 0x60, 0x00})
+	case bytes.HasPrefix(cmd, []byte{0x18, 0x40}) && len(cmd) >= 10:
+		return e.eraseTrack(cmd[:2], cmd[2:])
+	case bytes.HasPrefix(cmd, []byte{0x18, 0x43}) && len(cmd) >= 15:
+		return e.moveTrack(cmd[:2], cmd[2:])
+	case bytes.HasPrefix(cmd, []byte{0x18, 0xc3}) && len(cmd) >= 7:
+		return e.playbackControl(cmd[:2], cmd[2:])
+	case bytes.HasPrefix(cmd, []byte{0x18, 0xc5}) && len(cmd) >= 7:
+		e.seek(e.current, 0)
+		e.action = 0
+		return emulatorResponse(ControlAccepted, cmd[:2], append([]byte{0x00}, cmd[3:7]...))
+	case bytes.HasPrefix(cmd, []byte{0x18, 0x50}) && len(cmd) >= 10:
+		return e.trackChange(cmd[:2], cmd[2:])
+	case bytes.HasPrefix(cmd, []byte{0x18, 0x09, 0x80, 0x01, 0x04, 0x30}) && len(cmd) >= 20:
+		return e.positionResponse(cmd[:6], cmd[6:20])
+	}
+	if len(cmd) < 2 {
+		return emulatorResponse(ControlStub, cmd, nil)
+	}
+	return emulatorResponse(ControlStub, cmd[:2], cmd[2:])
+}
+
+func (e *Emulator) handleSecure(check, payload []byte) []byte {
+	cmd := check[9]
+	switch cmd {
+	case 0x80: // enter secure session
+		e.secure = true
+		return emulatorResponse(ControlAccepted, check, payload)
+	case 0x81: // leave secure session, also accepted when none was entered
+		e.secure = false
+		e.send = nil
+		e.upload = nil
+		return emulatorResponse(ControlAccepted, check, payload)
+	case 0x2b, 0x21: // track protection and forget secure key
+		return emulatorResponse(ControlAccepted, check, payload)
+	}
+	if !e.secure {
+		return emulatorResponse(ControlRejected, check, payload)
+	}
+	switch cmd {
+	case 0x12: // key data
+		return emulatorResponse(ControlAccepted, check, payload)
+	case 0x20: // session key exchange
+		if len(payload) < 12 {
+			return emulatorResponse(ControlRejected, check, payload)
+		}
+		e.ekb.nonce.Host = append([]byte{}, payload[4:12]...)
+		e.ekb.nonce.Dev = make([]byte, 8)
+		for i := range e.ekb.nonce.Dev {
+			e.ekb.nonce.Dev[i] = byte(rand.Int()) & 0xff
+		}
+		body := []byte{0xff, 0x00, 0x00, 0x00}
+		body = append(body, e.ekb.nonce.Dev...)
+		return emulatorResponse(ControlAccepted, check, body)
+	case 0x22: // kek exchange
+		if len(payload) < 35 || e.ekb.nonce.Dev == nil {
+			return emulatorResponse(ControlRejected, check, payload)
+		}
+		sessionKey, err := e.ekb.RetailMAC()
+		if err != nil {
+			return emulatorResponse(ControlRejected, check, payload)
+		}
+		blk, err := des.NewCipher(sessionKey)
+		if err != nil {
+			return emulatorResponse(ControlRejected, check, payload)
+		}
+		d := make([]byte, 32)
+		cipher.NewCBCDecrypter(blk, e.ekb.iv).CryptBlocks(d, payload[3:35])
+		e.kek = d[24:32]
+		return emulatorResponse(ControlAccepted, check, payload[:3])
+	case 0x28: // start secure send
+		if len(payload) < 19 || e.kek == nil || !e.edit() {
+			return emulatorResponse(ControlRejected, check, payload)
+		}
+		e.send = &emulatedSend{
+			format:     WireFormat(payload[9]),
+			discFormat: DiscFormat(payload[10]),
+			frames:     int(hexToInt32(payload[11:15])),
+			totalBytes: int(hexToInt32(payload[15:19])),
+		}
+		return emulatorResponse(ControlInterim, check, payload)
+	case 0x48: // commit track
+		return emulatorResponse(ControlAccepted, check, payload)
+	case 0x30: // upload track, the track number starts from 1
+		if len(payload) < 6 || hexToInt16(payload[4:6]) < 1 {
+			return emulatorResponse(ControlRejected, check, payload)
+		}
+		t, ok := e.track(intToHex16(int16(hexToInt16(payload[4:6]) - 1)))
+		if !ok {
+			return emulatorResponse(ControlRejected, check, payload)
+		}
+		e.upload = &emulatedUpload{check: check, trk: payload[4:6], data: t.discData()}
+		body := []byte{0x00, 0x00, 0x10, 0x01}
+		body = append(body, payload[4:6]...)
+		body = append(body, byte(t.Encoding.DiscFormat(t.Channels)))
+		body = append(body, intToHex32(int32(len(e.upload.data)))...)
+		return emulatorResponse(ControlInterim, check, body)
+	}
+	return emulatorResponse(ControlStub, check, payload)
+}
+
+// receiveSend decrypts the bulk data as it arrives, the first 24 bytes hold the length, the data key and the iv
+func (e *Emulator) receiveSend(data []byte) error {
+	e.send.received += len(data)
+	e.send.pending = append(e.send.pending, data...)
+	if e.send.decrypter == nil {
+		if len(e.send.pending) < 24 {
+			return nil
+		}
+		key, err := DESEncrypt(e.send.pending[8:16], e.kek)
+		if err != nil {
+			return err
+		}
+		blk, err := des.NewCipher(key)
+		if err != nil {
+			return err
+		}
+		e.send.decrypter = cipher.NewCBCDecrypter(blk, e.send.pending[16:24])
+		e.send.pending = e.send.pending[24:]
+	}
+	n := len(e.send.pending) - len(e.send.pending)%8
+	d := make([]byte, n)
+	e.send.decrypter.CryptBlocks(d, e.send.pending[:n])
+	if !e.Discard {
+		e.send.data = append(e.send.data, d...)
+	}
+	e.send.pending = append([]byte{}, e.send.pending[n:]...)
+	return nil
+}
+
+// finishSend adds the decrypted data as a new track, it returns the new track number
+func (e *Emulator) finishSend() (int, error) {
+	if e.send.decrypter == nil || len(e.send.pending) != 0 {
+		return 0, errors.New("emulator: invalid bulk data length")
+	}
+
+	channels := ChanStereo
+	if e.send.discFormat == DfMonoSP {
+		channels = ChanMono
+	}
+	t := &EmulatedTrack{
+		Encoding: wireFormatToEncoding(e.send.format),
+		Channels: channels,
+		Flag:     TrackUnprotected,
+		Format:   e.send.format,
+		Frames:   e.send.frames,
+		Data:     e.send.data,
+	}
+	e.Tracks = append(e.Tracks, t)
+	return len(e.Tracks) - 1, nil
+}
+
+// discData returns the audio of the track as it is stored on the disc, the Emulator has no ATRAC encoder so SP tracks
+// and tracks without Data hold silence
+func (t *EmulatedTrack) discData() []byte {
+	if t.Encoding == EncSP {
+		channels := 2
+		if t.Channels == ChanMono {
+			channels = 1
+		}
+		// a sound unit of long blocks without any coded block floating unit
+		su := make([]byte, soundUnitSize)
+		su[0], su[soundUnitSize-1] = 0xac, 0xac
+		d := make([]byte, 0, t.Frames*soundUnitSize*channels)
+		for i := 0; i < t.Frames*channels; i++ {
+			d = append(d, su...)
+		}
+		return d
+	}
+	if t.Data != nil {
+		return t.Data
+	}
+	// sound units of only the unit id without any coded band, LP2 holds one in each half of the frame, the second unit
+	// of the joint stereo LP4 frame is stored backwards from the end with the weighting and matrix selectors before it
+	format := encodingToWireFormat(t.Encoding)
+	frameSize := 2 * FrameSize[format]
+	frame := make([]byte, frameSize)
+	frame[0] = 0xa0
+	if format == WfLP2 {
+		frame[frameSize/2] = 0xa0
+	} else {
+		frame[frameSize-2], frame[frameSize-1] = 0xfc, 0x7f
+	}
+	frames := (t.Frames*FrameSize[format] + frameSize - 1) / frameSize
+	d := make([]byte, 0, frames*frameSize)
+	for i := 0; i < frames; i++ {
+		d = append(d, frame...)
+	}
+	return d
+}
+
+func (e *Emulator) track(b []byte) (*EmulatedTrack, bool) {
+	i := int(hexToInt16(b))
+	if !e.Present || i >= len(e.Tracks) {
+		return nil, false
+	}
+	return e.Tracks[i], true
+}
+
+func (e *Emulator) recorded() (frames int) {
+	for _, t := range e.Tracks {
+		frames += t.Frames
+	}
+	return
+}
+
+func (e *Emulator) discCapacity(check []byte) []byte {
+	recorded := e.recorded()
+	total := secondsToFrames(e.Capacity)
+	available := total - recorded
+	if available < 0 {
+		available = 0
+	}
+	body := []byte{0x30, 0x80, 0x03, 0x00, 0x10, 0x00, 0x00, 0x1d, 0x00, 0x00, 0x00, 0x1b, 0x80, 0x03, 0x00, 0x17, 0x80, 0x00}
+	for _, f := range []int{recorded, total, available} {
+		body = append(body, 0x00, 0x05)
+		body = append(body, framesToBcd(f)...)
+	}
+	return emulatorResponse(ControlAccepted, check, body)
+}
+
+func (e *Emulator) trackCount(check []byte) []byte {
+	c := 0
+	if e.Present {
+		c = len(e.Tracks)
+	}
+	body := []byte{0x30, 0x00, 0x10, 0x00, 0x10, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}
+	body = append(body, intToHex16(int16(c))...)
+	return emulatorResponse(ControlAccepted, check, body)
+}
+
+func (e *Emulator) titleResponse(check, trk []byte, title string) []byte {
+	l := intToHex16(int16(len(title)))
+	body := append([]byte{}, trk...)
+	body = append(body, 0x30, 0x00, 0x0a, 0x00, 0x10, 0x00)
+	body = append(body, l...)
+	body = append(body, 0x00, 0x00, 0x00, 0x00, 0x00, 0x0a)
+	body = append(body, l...)
+	body = append(body, []byte(title)...)
+	return emulatorResponse(ControlAccepted, check, body)
+}
+
+func (e *Emulator) trackEncoding(check, trk []byte) []byte {
+	t, ok := e.track(trk)
+	if !ok {
+		return emulatorResponse(ControlRejected, check, trk)
+	}
+	body := append([]byte{}, trk...)
+	body = append(body, 0x30, 0x80, 0x07, 0x00, 0x10, 0x00, 0x00, 0x01, 0x00, 0x07, byte(t.Encoding), byte(t.Channels))
+	return emulatorResponse(ControlAccepted, check, body)
+}
+
+// trackFlag answers both the flag (0x01) and length (0x02) queries which share the same check
+func (e *Emulator) trackFlag(check, payload []byte) []byte {
+	t, ok := e.track(payload[4:6])
+	if !ok {
+		return emulatorResponse(ControlRejected, check, payload)
+	}
+	body := append([]byte{}, payload[:6]...)
+	if payload[0] == 0x01 {
+		body = append(body, 0x10, 0x00, 0x00, 0x01, 0x00, 0x08, byte(t.Flag))
+		return emulatorResponse(ControlAccepted, check, body)
+	}
+	body = append(body, 0x30, 0x00, 0x01, 0x00, 0x10, 0x00, 0x00, 0x01, 0x00, 0x06, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00)
+	body = append(body, framesToBcd(t.Frames)[1:]...)
+	return emulatorResponse(ControlAccepted, check, body)
+}
+
+func (e *Emulator) recordingParameters(check []byte) []byte {
+	body := []byte{0x88, 0x01, 0x00, 0x30, 0x88, 0x05, 0x00, 0x30, 0x88, 0x07, 0x00, 0x10, 0x00}
+	body = append(body, make([]byte, 14)...)
+	body = append(body, byte(e.RecEncoding), byte(e.RecChannels))
+	return emulatorResponse(ControlAccepted, check, body)
+}
+
+func (e *Emulator) status(check []byte) []byte {
+	disc := byte(0x80)
+	if e.Present {
+		disc = 0x40
+	}
+	body := []byte{0x88, 0x00, 0x00, 0x30, 0x88, 0x04, 0x00, 0x10, 0x00, 0x00, 0x09, 0x00, 0x00}
+	body = append(body, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, disc, 0x00, 0x00)
+	return emulatorResponse(ControlAccepted, check, body)
+}
+
+func (e *Emulator) discFlags(check []byte) []byte {
+	if !e.Present {
+		return emulatorResponse(ControlRejected, check, nil)
+	}
+	flags := byte(0x10)
+	if e.WriteProtected {
+		flags |= discFlagWriteProtected
+	}
+	return emulatorResponse(ControlAccepted, check, []byte{0x10, 0x00, 0x00, 0x01, 0x00, 0x0b, flags})
+}
+
+// edit reports if the disc can be edited
+func (e *Emulator) edit() bool {
+	return e.Present && !e.WriteProtected
+}
+
+func (e *Emulator) operatingStatus(check, payload []byte) []byte {
+	status := OpReady
+	switch {
+	case !e.Present:
+		status = OpNoDisc
+	case e.Busy:
+		status = OpReadingTOC
+	case e.action == actionPlay:
+		status = OpPlaying
+	case e.action == actionPause:
+		status = OpPaused
+	case e.action == actionFastForward:
+		status = OpFastForward
+	case e.action == actionRewind:
+		status = OpRewind
+	}
+	body := append([]byte{}, payload...)
+	body = append(body, 0x00, 0x10, 0x00, 0x00, 0x1b, 0x00, 0x00, 0x00, 0x06, 0x88, 0x06, 0x00, 0x02)
+	body = append(body, intToHex16(int16(status))...)
+	return emulatorResponse(ControlAccepted, check, body)
+}
+
+func (e *Emulator) eraseDisc(check, payload []byte) []byte {
+	if !e.edit() {
+		return emulatorResponse(ControlRejected, check, payload)
+	}
+	e.Tracks = nil
+	e.Header = ""
+	e.action = 0
+	e.seek(0, 0)
+	return emulatorResponse(ControlAccepted, check, []byte{0x00, 0x00, 0x00})
+}
+
+func (e *Emulator) eraseTrack(check, payload []byte) []byte {
+	i := int(hexToInt16(payload[6:8]))
+	if !e.Present || i >= len(e.Tracks) || !e.edit() {
+		return emulatorResponse(ControlRejected, check, payload)
+	}
+	e.Tracks = append(e.Tracks[:i], e.Tracks[i+1:]...)
+	if e.current >= len(e.Tracks) && e.current > 0 {
+		e.seek(e.current-1, 0)
+	}
+	return emulatorResponse(ControlAccepted, check, payload)
+}
+
+func (e *Emulator) moveTrack(check, payload []byte) []byte {
+	from := int(hexToInt16(payload[6:8]))
+	to := int(hexToInt16(payload[11:13]))
+	if !e.Present || from >= len(e.Tracks) || to >= len(e.Tracks) || !e.edit() {
+		return emulatorResponse(ControlRejected, check, payload)
+	}
+	t := e.Tracks[from]
+	e.Tracks = append(e.Tracks[:from], e.Tracks[from+1:]...)
+	e.Tracks = append(e.Tracks[:to], append([]*EmulatedTrack{t}, e.Tracks[to:]...)...)
+	return emulatorResponse(ControlAccepted, check, payload)
+}
+
+func (e *Emulator) playbackControl(check, payload []byte) []byte {
+	if !e.Present || len(e.Tracks) == 0 {
+		return emulatorResponse(ControlRejected, check, payload)
+	}
+	e.seek(e.current, e.position())
+	e.action = playbackAction(payload[1])
+	return emulatorResponse(ControlAccepted, check, append([]byte{0x00}, payload[1:5]...))
+}
+
+// trackChange handles the next and previous (0x10), goto track (0x01) and goto time (0x00) commands
+func (e *Emulator) trackChange(check, payload []byte) []byte {
+	if !e.Present || len(e.Tracks) == 0 {
+		return emulatorResponse(ControlRejected, check, payload)
+	}
+	trk := int(hexToInt16(payload[6:8]))
+	switch payload[1] {
+	case 0x10:
+		switch trackDirection(trk) {
+		case directionNext:
+			if e.current < len(e.Tracks)-1 {
+				e.seek(e.current+1, 0)
+			}
+		case directionPrevious:
+			if e.current > 0 {
+				e.seek(e.current-1, 0)
+			}
+		default:
+			return emulatorResponse(ControlRejected, check, payload)
+		}
+	case 0x01:
+		if trk >= len(e.Tracks) {
+			return emulatorResponse(ControlRejected, check, payload)
+		}
+		e.seek(trk, 0)
+	case 0x00:
+		if trk >= len(e.Tracks) || len(payload) < 12 {
+			return emulatorResponse(ControlRejected, check, payload)
+		}
+		seconds, err := bcdToSeconds(payload[8:11])
+		frame, ferr := bcdToInt(payload[11])
+		if err != nil || ferr != nil {
+			return emulatorResponse(ControlRejected, check, payload)
+		}
+		frames := int((seconds*44100 + frame*512 + 511) / 512)
+		if frames > e.Tracks[trk].Frames {
+			return emulatorResponse(ControlRejected, check, payload)
+		}
+		e.seek(trk, frames)
+	default:
+		return emulatorResponse(ControlRejected, check, payload)
+	}
+	return emulatorResponse(ControlAccepted, check, append([]byte{0x00}, payload[1:]...))
+}
+
+// seek moves the playback to the sound group in trk
+func (e *Emulator) seek(trk, frames int) {
+	e.current = trk
+	e.elapsed = frames
+	e.since = time.Now()
+}
+
+// position returns the sound groups played of the current track, it runs on while playing
+func (e *Emulator) position() int {
+	if e.current >= len(e.Tracks) {
+		return 0
+	}
+	p := e.elapsed
+	if e.action == actionPlay {
+		p += int(time.Since(e.since).Seconds() * 44100 / 512)
+	}
+	if p > e.Tracks[e.current].Frames {
+		p = e.Tracks[e.current].Frames
+	}
+	return p
+}
+
+func (e *Emulator) positionResponse(check, payload []byte) []byte {
+	body := append([]byte{}, payload...)
+	body = append(body, 0x00, 0x10, 0x00, 0x00, 0x1b, 0x00, 0x00, 0x00, 0x0b, 0x00, 0x02, 0x00, 0x07, 0x00)
+	body = append(body, intToHex16(int16(e.current))...)
+	body = append(body, framesToBcd(e.position())[1:]...)
+	return emulatorResponse(ControlAccepted, check, body)
+}
+
+func emulatorResponse(control Control, check, body []byte) []byte {
+	r := []byte{byte(control)}
+	r = append(r, check...)
+	r = append(r, body...)
+	return r
+}
+
+// secondsToFrames rounds up so the duration survives the conversion back to seconds
+func secondsToFrames(s uint64) int {
+	return int((s*44100 + 511) / 512)
+}
+
+// framesToBcd encodes a number of sound frames (512 samples) as bcd hours (2 bytes), minutes, seconds and frames
+func framesToBcd(frames int) []byte {
+	samples := frames * 512
+	seconds := samples / 44100
+	return []byte{
+		0x00,
+		intToBcd(uint64(seconds / 3600)),
+		intToBcd(uint64(seconds / 60 % 60)),
+		intToBcd(uint64(seconds % 60)),
+		intToBcd(uint64(samples % 44100 / 512)),
+	}
+}
+
+func encodingToWireFormat(enc Encoding) WireFormat {
+	switch enc {
+	case EncLP2:
+		return WfLP2
+	case EncLP4:
+		return WfLP4
+	}
+	return WfPCM
+}
+
+func wireFormatToEncoding(f WireFormat) Encoding {
+	switch f {
+	case WfLP2:
+		return EncLP2
+	case WfLP4:
+		return EncLP4
+	}
+	return EncSP
+}
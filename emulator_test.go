@@ -0,0 +1,206 @@
+package netmd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+// testWav returns a 16 bit 44100 Hz pcm wav of seconds length
+func testWav(channels, seconds int) []byte {
+	data := make([]byte, 44100*2*channels*seconds)
+	for i := 0; i+1 < len(data); i += 2 {
+		binary.LittleEndian.PutUint16(data[i:], uint16(i*7))
+	}
+	h := &wavHeader{
+		format:        waveFormatPCM,
+		channels:      channels,
+		sampleRate:    44100,
+		byteRate:      44100 * 2 * channels,
+		blockAlign:    2 * channels,
+		bitsPerSample: 16,
+		dataSize:      int64(len(data)),
+	}
+	var b bytes.Buffer
+	h.write(&b, nil)
+	b.Write(data)
+	return b.Bytes()
+}
+
+func sendTestTrack(t *testing.T, md *NetMD, title string, channels, seconds int) *SendResult {
+	t.Helper()
+	w := testWav(channels, seconds)
+	trk, err := md.NewTrackFromReader(title, bytes.NewReader(w), int64(len(w)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := md.SendTrack(trk, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+func TestEmulator(t *testing.T) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, emu *Emulator, md *NetMD)
+	}{
+		{"send, list and erase", func(t *testing.T, emu *Emulator, md *NetMD) {
+			res := sendTestTrack(t, md, "First", 2, 2)
+			if res.Stage != StageDone || res.Track != 0 {
+				t.Fatalf("send result %+v", res)
+			}
+			sendTestTrack(t, md, "Second", 2, 1)
+			if c, err := md.RequestTrackCount(); err != nil || c != 2 {
+				t.Fatalf("track count %d, %v", c, err)
+			}
+			if title, err := md.RequestTrackTitle(1); err != nil || title != "Second" {
+				t.Fatalf("track title %q, %v", title, err)
+			}
+			if err := md.EraseTrack(0); err != nil {
+				t.Fatal(err)
+			}
+			if title, err := md.RequestTrackTitle(0); err != nil || title != "Second" {
+				t.Fatalf("track title after erase %q, %v", title, err)
+			}
+		}},
+		{"mono pcm keeps its length", func(t *testing.T, emu *Emulator, md *NetMD) {
+			sendTestTrack(t, md, "Mono", 1, 3)
+			if l, err := md.RequestTrackLength(0); err != nil || l != 3 {
+				t.Fatalf("track length %d, %v", l, err)
+			}
+			if emu.Tracks[0].Channels != ChanMono {
+				t.Fatalf("channels %#x", emu.Tracks[0].Channels)
+			}
+		}},
+		{"protected track", func(t *testing.T, emu *Emulator, md *NetMD) {
+			emu.AddTrack("Keep", EncSP, ChanStereo, 10)
+			emu.Tracks[0].Flag = TrackProtected
+			var perr *ProtectedError
+			if err := md.EraseTrack(0); !errors.As(err, &perr) || perr.Track != 0 {
+				t.Fatalf("erase returned %v", err)
+			}
+			if err := md.ForceEraseTrack(0); err != nil {
+				t.Fatal(err)
+			}
+		}},
+		{"erase disc", func(t *testing.T, emu *Emulator, md *NetMD) {
+			emu.Header = "0;Album//1-2;Side A//"
+			for _, title := range []string{"A", "B", "C"} {
+				emu.AddTrack(title, EncSP, ChanStereo, 10)
+			}
+			if err := md.EraseDisc(); err != nil {
+				t.Fatal(err)
+			}
+			if c, err := md.RequestTrackCount(); err != nil || c != 0 {
+				t.Fatalf("track count %d, %v after erasing the disc", c, err)
+			}
+			if h, err := md.RequestDiscHeader(); err != nil || h != "" {
+				t.Fatalf("disc header %q, %v after erasing the disc", h, err)
+			}
+		}},
+		{"erase disc with a protected track", func(t *testing.T, emu *Emulator, md *NetMD) {
+			for _, title := range []string{"A", "B", "C"} {
+				emu.AddTrack(title, EncSP, ChanStereo, 10)
+			}
+			emu.Tracks[1].Flag = TrackProtected
+			var perr *ProtectedError
+			if err := md.EraseDisc(); !errors.As(err, &perr) || perr.Track != 1 {
+				t.Fatalf("erase returned %v", err)
+			}
+			if c, err := md.RequestTrackCount(); err != nil || c != 3 {
+				t.Fatalf("track count %d, %v after the refused erase", c, err)
+			}
+			if err := md.ForceEraseDisc(); err != nil {
+				t.Fatal(err)
+			}
+			if c, err := md.RequestTrackCount(); err != nil || c != 0 {
+				t.Fatalf("track count %d, %v after forcing the erase", c, err)
+			}
+		}},
+		{"write protected disc", func(t *testing.T, emu *Emulator, md *NetMD) {
+			emu.AddTrack("Old", EncSP, ChanStereo, 10)
+			emu.WriteProtected = true
+			if err := md.SetTrackTitle(0, "New", false); !errors.Is(err, ErrRejected) {
+				t.Fatalf("title on a write protected disc returned %v", err)
+			}
+			s, err := md.RequestDeviceStatus()
+			if err != nil || !s.DiscPresent || !s.WriteProtected {
+				t.Fatalf("device status %+v, %v", s, err)
+			}
+		}},
+		{"recording parameters", func(t *testing.T, emu *Emulator, md *NetMD) {
+			emu.RecEncoding = EncLP2
+			if e, c, err := md.RecordingParameters(); err != nil || e != EncLP2 || c != ChanStereo {
+				t.Fatalf("recording parameters %#x %#x, %v", e, c, err)
+			}
+		}},
+		{"read disc with a malformed group", func(t *testing.T, emu *Emulator, md *NetMD) {
+			emu.Header = "0;Album//x-2;Side B//2;Solo//"
+			emu.AddTrack("A", EncSP, ChanStereo, 10)
+			emu.AddTrack("B", EncSP, ChanStereo, 10)
+			d, err := md.ReadDisc()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if d.HeaderError == nil || d.Title != "Album" || len(d.Tracks) != 2 || len(d.Groups) != 1 ||
+				d.Groups[0].Title != "Solo" || d.Tracks[0].Group != -1 || d.Tracks[1].Group != 0 {
+				t.Fatalf("disc %+v", d)
+			}
+			emu.Header = "0;Album//1;Solo//"
+			d, err = md.ReadDisc()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if d.HeaderError != nil || len(d.Groups) != 1 || d.Groups[0].First != 0 || d.Groups[0].Last != 0 || d.Tracks[0].Group != 0 {
+				t.Fatalf("disc %+v", d)
+			}
+		}},
+		{"read disc", func(t *testing.T, emu *Emulator, md *NetMD) {
+			emu.Header = "0;Album//2-2;Side B//"
+			emu.AddTrack("A", EncSP, ChanStereo, 10)
+			emu.AddTrack("B", EncLP2, ChanStereo, 20)
+			d, err := md.ReadDisc()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if d.Title != "Album" || len(d.Tracks) != 2 || d.Tracks[0].Group != -1 || d.Tracks[1].Group != 0 ||
+				d.Groups[0].First != 1 || d.Tracks[1].Encoding != EncLP2 {
+				t.Fatalf("disc %+v", d)
+			}
+		}},
+		{"disc capacity", func(t *testing.T, emu *Emulator, md *NetMD) {
+			emu.AddTrack("A", EncSP, ChanStereo, 10)
+			emu.AddTrack("B", EncSP, ChanStereo, 20)
+			// the times are whole seconds rounded down, the available time can be one less than the rest
+			recorded, total, available, err := md.RequestDiscCapacity()
+			if err != nil || recorded != 30 || total != 80*60 || available+recorded+1 < total || available+recorded > total {
+				t.Fatalf("capacity %d/%d/%d, %v", recorded, total, available, err)
+			}
+		}},
+		{"download", func(t *testing.T, emu *Emulator, md *NetMD) {
+			emu.AddTrack("SP", EncSP, ChanStereo, 1)
+			emu.AddTrack("LP2", EncLP2, ChanStereo, 1)
+			var sp, lp bytes.Buffer
+			if err := md.DownloadTrack(0, &sp, nil); err != nil {
+				t.Fatal(err)
+			}
+			if err := md.DownloadTrack(1, &lp, nil); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.HasPrefix(sp.Bytes(), aeaMagic) || !bytes.HasPrefix(lp.Bytes(), []byte("RIFF")) {
+				t.Fatalf("downloads start with % x and % x", sp.Bytes()[:4], lp.Bytes()[:4])
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			emu := NewEmulator()
+			md := NewNetMDWithTransport(emu, false)
+			defer md.Close()
+			tt.run(t, emu, md)
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package netmd
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrRejected       = errors.New("netmd: command was rejected")
+	ErrTimeout        = errors.New("netmd: timed out")
+	ErrShortResponse  = errors.New("netmd: response too short")
+	ErrNotImplemented = errors.New("netmd: command not implemented")
+	ErrNoDevice       = errors.New("netmd: no compatible device found")
+	ErrProtected      = errors.New("netmd: track is protected")
+	ErrNoCodec        = errors.New("netmd: no ATRAC codec registered, import github.com/enimatek-nl/go-netmd-lib/atrac/codec")
+)
+
+// RejectedError is returned when the device answered a command with ControlRejected
+type RejectedError struct {
+	Command  []byte
+	Response []byte
+}
+
+func (e *RejectedError) Error() string {
+	return fmt.Sprintf("%s: % x", ErrRejected, e.Command)
+}
+
+func (e *RejectedError) Unwrap() error {
+	return ErrRejected
+}
+
+// NotImplementedError is returned when the device answered a command with ControlStub
+type NotImplementedError struct {
+	Command  []byte
+	Response []byte
+}
+
+func (e *NotImplementedError) Error() string {
+	return fmt.Sprintf("%s: % x", ErrNotImplemented, e.Command)
+}
+
+func (e *NotImplementedError) Unwrap() error {
+	return ErrNotImplemented
+}
+
+// TimeoutError is returned when no response matching the command was received in time
+type TimeoutError struct {
+	Command []byte
+	Tries   int
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("%s after %d tries: % x", ErrTimeout, e.Tries, e.Command)
+}
+
+func (e *TimeoutError) Unwrap() error {
+	return ErrTimeout
+}
+
+// ShortResponseError is returned when a response is shorter than the fields that are read from it
+type ShortResponseError struct {
+	Response []byte
+	Want     int
+}
+
+func (e *ShortResponseError) Error() string {
+	return fmt.Sprintf("%s: got %d bytes, want %d", ErrShortResponse, len(e.Response), e.Want)
+}
+
+func (e *ShortResponseError) Unwrap() error {
+	return ErrShortResponse
+}
+
+// NoDeviceError is returned when no compatible device was found at Index, Err holds the usb error if any
+type NoDeviceError struct {
+	Index int
+	Found int
+	Err   error
+}
+
+func (e *NoDeviceError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %s", ErrNoDevice, e.Err)
+	}
+	return fmt.Sprintf("%s: index %d, found %d", ErrNoDevice, e.Index, e.Found)
+}
+
+func (e *NoDeviceError) Is(target error) bool {
+	return target == ErrNoDevice
+}
+
+func (e *NoDeviceError) Unwrap() error {
+	return e.Err
+}
+
+// ProtectedError is returned when a protected Track would be erased without forcing it
+type ProtectedError struct {
+	Track int
+}
+
+func (e *ProtectedError) Error() string {
+	return fmt.Sprintf("%s: track %d", ErrProtected, e.Track)
+}
+
+func (e *ProtectedError) Unwrap() error {
+	return ErrProtected
+}
+
+// expect returns a ShortResponseError when r is shorter than n bytes
+func expect(r []byte, n int) error {
+	if len(r) < n {
+		return &ShortResponseError{Response: r, Want: n}
+	}
+	return nil
+}
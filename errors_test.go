@@ -0,0 +1,139 @@
+package netmd
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+)
+
+// answeringTransport answers every command that starts with prefix itself with control and the prefix, without any
+// payload, a zero control never answers
+type answeringTransport struct {
+	Transport
+	prefix  []byte
+	control Control
+	reply   []byte
+}
+
+func (a *answeringTransport) ControlOut(request uint8, data []byte) (int, error) {
+	if !bytes.HasPrefix(data, a.prefix) {
+		return a.Transport.ControlOut(request, data)
+	}
+	if a.control != 0 {
+		a.reply = append([]byte{byte(a.control)}, a.prefix[1:]...)
+	}
+	return len(data), nil
+}
+
+func (a *answeringTransport) Poll(data []byte) (int, error) {
+	if a.reply == nil {
+		return a.Transport.Poll(data)
+	}
+	copy(data, []byte{0x01, 0x81, byte(len(a.reply)), 0x00})
+	return 4, nil
+}
+
+func (a *answeringTransport) ControlIn(request uint8, data []byte) (int, error) {
+	if a.reply == nil {
+		return a.Transport.ControlIn(request, data)
+	}
+	n := copy(data, a.reply)
+	a.reply = nil
+	return n, nil
+}
+
+// withPollInterval sets the pollInterval until the end of the test
+func withPollInterval(t *testing.T, d time.Duration) {
+	prev := pollInterval
+	pollInterval = d
+	t.Cleanup(func() { pollInterval = prev })
+}
+
+var trackCountCheck = []byte{0x00, 0x18, 0x06, 0x02, 0x10, 0x10, 0x01}
+
+func TestErrors(t *testing.T) {
+	withPollInterval(t, time.Millisecond)
+
+	emu := NewEmulator()
+	emu.AddTrack("Old", EncSP, ChanStereo, 10)
+	emu.WriteProtected = true
+	var rerr *RejectedError
+	if err := NewNetMDWithTransport(emu, false).SetTrackTitle(0, "New", false); !errors.Is(err, ErrRejected) ||
+		!errors.As(err, &rerr) || len(rerr.Command) == 0 || len(rerr.Response) == 0 {
+		t.Fatalf("rejected command returned %v", err)
+	}
+
+	md := NewNetMDWithTransport(&answeringTransport{Transport: NewEmulator(), prefix: trackCountCheck, control: ControlStub}, false)
+	var nerr *NotImplementedError
+	if _, err := md.RequestTrackCount(); !errors.Is(err, ErrNotImplemented) || !errors.As(err, &nerr) ||
+		!bytes.HasPrefix(nerr.Command, trackCountCheck) || Control(nerr.Response[0]) != ControlStub {
+		t.Fatalf("stubbed command returned %v", err)
+	}
+
+	md = NewNetMDWithTransport(&answeringTransport{Transport: NewEmulator(), prefix: trackCountCheck, control: ControlAccepted}, false)
+	var serr *ShortResponseError
+	if _, err := md.RequestTrackCount(); !errors.Is(err, ErrShortResponse) || !errors.As(err, &serr) ||
+		serr.Want <= len(serr.Response) {
+		t.Fatalf("short response returned %v", err)
+	}
+
+	md = NewNetMDWithTransport(&answeringTransport{Transport: NewEmulator(), prefix: trackCountCheck}, false)
+	var terr *TimeoutError
+	if _, err := md.RequestTrackCount(); !errors.Is(err, ErrTimeout) || !errors.As(err, &terr) ||
+		terr.Tries != 300 || !bytes.HasPrefix(terr.Command, trackCountCheck) {
+		t.Fatalf("unanswered command returned %v", err)
+	}
+
+	// no usb bus (or no device at this index) can be opened in a test
+	var derr *NoDeviceError
+	if _, err := NewNetMD(1<<20, false); !errors.Is(err, ErrNoDevice) || !errors.As(err, &derr) || derr.Index != 1<<20 {
+		t.Fatalf("opening a missing device returned %v", err)
+	}
+}
+
+func TestStubbedSecureSession(t *testing.T) {
+	// commands around the transfer whose reply is not read succeed when a (Sharp) deck stubs them, the key exchange is
+	// left out because the emulator needs it to decrypt the audio
+	stubbed := [][]byte{
+		{0x00, 0x18, 0x00, 0x08, 0x00, 0x46, 0xf0, 0x03, 0x01, 0x03, 0x81}, // leave
+		{0x00, 0xff, 0x01},                                                 // acquire and release
+		{0x00, 0x18, 0x08, 0x10, 0x18, 0x02, 0x03},                         // cache toc
+		{0x00, 0x18, 0x08, 0x10, 0x18, 0x02, 0x00},                         // sync toc
+		{0x00, 0x18, 0x00, 0x08, 0x00, 0x46, 0xf0, 0x03, 0x01, 0x03, 0x48}, // commit
+		{0x00, 0x18, 0x00, 0x08, 0x00, 0x46, 0xf0, 0x03, 0x01, 0x03, 0x21}, // forget key
+	}
+	for _, prefix := range stubbed {
+		emu := NewEmulator()
+		md := NewNetMDWithTransport(&answeringTransport{Transport: emu, prefix: prefix, control: ControlStub}, false)
+		if res := sendTestTrack(t, md, "Sharp", 2, 1); res.Stage != StageDone {
+			t.Fatalf("send with % x stubbed ended at %s", prefix, res.Stage)
+		}
+		if len(emu.Tracks) != 1 {
+			t.Fatalf("send with % x stubbed left %d tracks", prefix, len(emu.Tracks))
+		}
+	}
+}
+
+func TestRejectedTrackFlag(t *testing.T) {
+	// a deck that does not answer the flag query has no protected tracks, erasing and reading the disc still work
+	flagQuery := []byte{0x00, 0x18, 0x06, 0x01, 0x20, 0x10, 0x01}
+	for _, control := range []Control{ControlRejected, ControlStub} {
+		emu := NewEmulator()
+		emu.AddTrack("A", EncSP, ChanStereo, 10)
+		emu.AddTrack("B", EncSP, ChanStereo, 10)
+		md := NewNetMDWithTransport(&answeringTransport{Transport: emu, prefix: flagQuery, control: control}, false)
+		if d, err := md.ReadDisc(); err != nil || len(d.Tracks) != 2 || d.Tracks[0].Protected {
+			t.Fatalf("read disc with the flag query answered %#x returned %+v, %v", control, d, err)
+		}
+		if err := md.EraseTrack(0); err != nil {
+			t.Fatalf("erase track with the flag query answered %#x returned %v", control, err)
+		}
+		if err := md.EraseDisc(); err != nil {
+			t.Fatalf("erase disc with the flag query answered %#x returned %v", control, err)
+		}
+		if c, err := md.RequestTrackCount(); err != nil || c != 0 {
+			t.Fatalf("track count %d, %v", c, err)
+		}
+	}
+}
@@ -2,4 +2,4 @@ module github.com/enimatek-nl/go-netmd-lib
 
 go 1.16
 
-require github.com/enimatek-nl/gousb v1.1.2-0.20210607143911-42b4d2b04d56 // indirect
+require github.com/enimatek-nl/gousb v1.1.2-0.20210607143911-42b4d2b04d56
@@ -7,17 +7,33 @@ import (
 )
 
 type Root struct {
-	Title  string
-	Groups []*Group
+	Title  string   `json:"title"`
+	Groups []*Group `json:"groups"`
 }
 
 type Group struct {
-	Title string
-	Start int
-	End   int
+	Title string `json:"title"`
+	Start int    `json:"start"`
+	End   int    `json:"end"`
 }
 
-func NewRoot(raw string) (fs *Root) {
+// NewRoot parses the raw disc header, groups with a malformed track range are left out
+func NewRoot(raw string) *Root {
+	fs, _ := parseRoot(raw)
+	return fs
+}
+
+// ParseRoot parses the raw disc header like NewRoot but returns an error when a group has a malformed track range
+func ParseRoot(raw string) (*Root, error) {
+	fs, err := parseRoot(raw)
+	if err != nil {
+		return nil, err
+	}
+	return fs, nil
+}
+
+// parseRoot returns the Root with the well-formed groups of raw and the error of the first malformed one
+func parseRoot(raw string) (fs *Root, err error) {
 	if strings.HasSuffix(raw, "//") {
 		parts := strings.Split(raw, "//")
 		title := ""
@@ -30,9 +46,13 @@ func NewRoot(raw string) (fs *Root) {
 					folder := &Group{
 						Title: parts[i][s+1:],
 					}
-					fromTo := strings.Split(parts[i][0:s], "-")
-					folder.Start, _ = strconv.Atoi(fromTo[0])
-					folder.End, _ = strconv.Atoi(fromTo[1])
+					var gerr error
+					if folder.Start, folder.End, gerr = parseRange(parts[i][0:s]); gerr != nil {
+						if err == nil {
+							err = fmt.Errorf("group %q: %w", parts[i], gerr)
+						}
+						continue
+					}
 					folders = append(folders, folder)
 				}
 			}
@@ -49,6 +69,17 @@ func NewRoot(raw string) (fs *Root) {
 	return
 }
 
+// parseRange parses the track range of a group, eg. "2-5" or "3" for a group of a single track
+func parseRange(r string) (start, end int, err error) {
+	fromTo := strings.Split(r, "-")
+	start, serr := strconv.Atoi(fromTo[0])
+	end, eerr := strconv.Atoi(fromTo[len(fromTo)-1])
+	if len(fromTo) > 2 || serr != nil || eerr != nil || start < 1 || end < start {
+		return 0, 0, fmt.Errorf("malformed track range %q", r)
+	}
+	return start, end, nil
+}
+
 func (fs *Root) ToString() string {
 	t := "0;"
 	t += fs.Title
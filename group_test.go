@@ -0,0 +1,52 @@
+package netmd
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseRoot(t *testing.T) {
+	tests := []struct {
+		name   string
+		raw    string
+		title  string
+		groups []*Group
+		err    bool
+	}{
+		{"plain title", "Album", "Album", nil, false},
+		{"no groups", "0;Album//", "Album", nil, false},
+		{"range", "0;Album//1-3;Side A//4-5;Side B//", "Album", []*Group{{"Side A", 1, 3}, {"Side B", 4, 5}}, false},
+		{"single track", "0;Album//1;Solo//", "Album", []*Group{{"Solo", 1, 1}}, false},
+		{"single and range", "0;//2;Intro//3-4;Rest//", "", []*Group{{"Intro", 2, 2}, {"Rest", 3, 4}}, false},
+		{"not a number", "0;Album//a-3;Side A//", "Album", nil, true},
+		{"empty range", "0;Album//;Side A//", "Album", nil, true},
+		{"open range", "0;Album//1-;Side A//", "Album", nil, true},
+		{"too many dashes", "0;Album//1-2-3;Side A//", "Album", nil, true},
+		{"reversed", "0;Album//3-1;Side A//", "Album", nil, true},
+		{"track zero", "0;Album//0-1;Side A//", "Album", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs, err := ParseRoot(tt.raw)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("parsed %+v", fs)
+				}
+				// NewRoot leaves the malformed group out instead
+				if fs = NewRoot(tt.raw); fs.Title != tt.title || len(fs.Groups) != 0 {
+					t.Fatalf("new root %+v", fs)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fs.Title != tt.title || !reflect.DeepEqual(fs.Groups, tt.groups) {
+				t.Fatalf("root %+v with groups %+v", fs, fs.Groups)
+			}
+			if nr := NewRoot(tt.raw); !reflect.DeepEqual(nr, fs) {
+				t.Fatalf("new root %+v differs from %+v", nr, fs)
+			}
+		})
+	}
+}
@@ -0,0 +1,275 @@
+package netmd
+
+import (
+	"encoding/binary"
+	"io"
+	"strings"
+	"unicode/utf16"
+)
+
+// Metadata holds the tags found in the RIFF INFO list or the embedded id3 chunk of a wav file, the ea3 tag of an oma file or the title of an aea file
+type Metadata struct {
+	Title  string
+	Artist string
+	Album  string
+}
+
+// DefaultTitleTemplate is used for tracks created with an empty title when no other template was set
+const DefaultTitleTemplate = "{title}"
+
+// SetTitleTemplate sets the template used to build the title of tracks created with an empty title,
+// {title}, {artist} and {album} are replaced with the Metadata of the file, eg. "{artist} - {title}"
+func (md *NetMD) SetTitleTemplate(t string) {
+	md.titleTemplate = t
+}
+
+// Format fills the template with the tags, a missing tag is removed together with the separator that follows it
+// (or precedes it when it is the last field), the tags themselves are never trimmed
+func (m *Metadata) Format(template string) string {
+	values := map[string]string{"{title}": m.Title, "{artist}": m.Artist, "{album}": m.Album}
+
+	// split the template in literal text and fields
+	type part struct {
+		text  string
+		field bool
+		drop  bool
+	}
+	var parts []part
+	for len(template) > 0 {
+		i := strings.Index(template, "{")
+		j := strings.Index(template[i+1:], "}")
+		if i == -1 || j == -1 {
+			parts = append(parts, part{text: template})
+			break
+		}
+		name := template[i : i+j+2]
+		if _, ok := values[name]; !ok {
+			parts = append(parts, part{text: template[:i+j+2]})
+		} else {
+			parts = append(parts, part{text: template[:i]}, part{text: values[name], field: true, drop: values[name] == ""})
+		}
+		template = template[i+j+2:]
+	}
+
+	separator := func(k int) bool {
+		return k >= 0 && k < len(parts) && !parts[k].field && !parts[k].drop && parts[k].text != "" &&
+			strings.Trim(parts[k].text, " -/") == ""
+	}
+	for k := range parts {
+		if !parts[k].field || !parts[k].drop {
+			continue
+		}
+		next := k + 1
+		for next < len(parts) && !parts[next].field && parts[next].text == "" {
+			next++
+		}
+		prev := k - 1
+		for prev >= 0 && !parts[prev].field && parts[prev].text == "" {
+			prev--
+		}
+		if separator(next) {
+			parts[next].drop = true
+		} else if separator(prev) {
+			parts[prev].drop = true
+		}
+	}
+
+	var b strings.Builder
+	for _, p := range parts {
+		if !p.drop {
+			b.WriteString(p.text)
+		}
+	}
+	return b.String()
+}
+
+func (m *Metadata) merge(o *Metadata) {
+	if o.Title != "" {
+		m.Title = o.Title
+	}
+	if o.Artist != "" {
+		m.Artist = o.Artist
+	}
+	if o.Album != "" {
+		m.Album = o.Album
+	}
+}
+
+// newMetadata parses the LIST and id3 chunks of a wav file, tags in id3 take precedence over the INFO list
+func newMetadata(chunks []*wavChunk) *Metadata {
+	m := &Metadata{}
+	for _, c := range chunks {
+		if c.id == "LIST" {
+			m.merge(parseInfoList(c.data))
+		}
+	}
+	for _, c := range chunks {
+		if c.id != "LIST" {
+			m.merge(parseID3(c.data))
+		}
+	}
+	return m
+}
+
+// parseInfoList reads the INAM, IART and IPRD sub chunks of a LIST chunk of type INFO
+func parseInfoList(b []byte) *Metadata {
+	m := &Metadata{}
+	if len(b) < 4 || string(b[0:4]) != "INFO" {
+		return m
+	}
+	b = b[4:]
+	for len(b) >= 8 {
+		id := string(b[0:4])
+		size := int(binary.LittleEndian.Uint32(b[4:8]))
+		b = b[8:]
+		if size > len(b) {
+			size = len(b)
+		}
+		v := strings.TrimSpace(strings.TrimRight(string(b[:size]), "\x00"))
+		switch id {
+		case "INAM":
+			m.Title = v
+		case "IART":
+			m.Artist = v
+		case "IPRD":
+			m.Album = v
+		}
+		size += size % 2
+		if size > len(b) {
+			break
+		}
+		b = b[size:]
+	}
+	return m
+}
+
+// parseID3 reads the title, artist and album text frames of an ID3v2.2, v2.3 or v2.4 tag,
+// the ea3 tag of OpenMG files is the same with a different magic
+func parseID3(b []byte) *Metadata {
+	m := &Metadata{}
+	if len(b) < 10 || (string(b[0:3]) != "ID3" && string(b[0:3]) != "ea3") {
+		return m
+	}
+	version := b[3]
+	flags := b[5]
+	size := syncSafe(b[6:10])
+	b = b[10:]
+	if size < len(b) {
+		b = b[:size]
+	}
+
+	// skip the extended header
+	if flags&0x40 != 0 && version >= 3 && len(b) >= 4 {
+		ext := int(binary.BigEndian.Uint32(b[0:4]))
+		if version == 3 {
+			ext += 4
+		} else {
+			ext = syncSafe(b[0:4])
+		}
+		if ext > len(b) {
+			return m
+		}
+		b = b[ext:]
+	}
+
+	idLen, hdrLen := 4, 10
+	if version == 2 {
+		idLen, hdrLen = 3, 6
+	}
+	for len(b) >= hdrLen && b[0] != 0x00 {
+		id := string(b[0:idLen])
+		var n int
+		switch version {
+		case 2:
+			n = int(b[3])<<16 | int(b[4])<<8 | int(b[5])
+		case 3:
+			n = int(binary.BigEndian.Uint32(b[4:8]))
+		default:
+			n = syncSafe(b[4:8])
+		}
+		b = b[hdrLen:]
+		if n > len(b) {
+			break
+		}
+		switch id {
+		case "TIT2", "TT2":
+			m.Title = id3Text(b[:n])
+		case "TPE1", "TP1":
+			m.Artist = id3Text(b[:n])
+		case "TALB", "TAL":
+			m.Album = id3Text(b[:n])
+		}
+		b = b[n:]
+	}
+	return m
+}
+
+// id3Text decodes the content of a text frame, the first byte holds the encoding
+func id3Text(b []byte) string {
+	if len(b) == 0 {
+		return ""
+	}
+	enc, b := b[0], b[1:]
+	var s string
+	switch enc {
+	case 0x01, 0x02: // utf-16 with bom, utf-16be
+		be := enc == 0x02
+		if len(b) >= 2 && b[0] == 0xfe && b[1] == 0xff {
+			be, b = true, b[2:]
+		} else if len(b) >= 2 && b[0] == 0xff && b[1] == 0xfe {
+			be, b = false, b[2:]
+		}
+		u := make([]uint16, 0, len(b)/2)
+		for i := 0; i+1 < len(b); i += 2 {
+			if be {
+				u = append(u, binary.BigEndian.Uint16(b[i:]))
+			} else {
+				u = append(u, binary.LittleEndian.Uint16(b[i:]))
+			}
+		}
+		s = string(utf16.Decode(u))
+	case 0x03: // utf-8
+		s = string(b)
+	default: // iso-8859-1
+		r := make([]rune, len(b))
+		for i, c := range b {
+			r[i] = rune(c)
+		}
+		s = string(r)
+	}
+	if i := strings.IndexRune(s, 0); i != -1 {
+		s = s[:i]
+	}
+	return strings.TrimSpace(s)
+}
+
+func syncSafe(b []byte) int {
+	return int(b[0]&0x7f)<<21 | int(b[1]&0x7f)<<14 | int(b[2]&0x7f)<<7 | int(b[3]&0x7f)
+}
+
+// readWavTrailer collects the metadata chunks that follow the audio data, r must be positioned after the data chunk
+func readWavTrailer(r io.Reader) []*wavChunk {
+	var chunks []*wavChunk
+	for {
+		c := make([]byte, 8)
+		if _, err := io.ReadFull(r, c); err != nil {
+			return chunks
+		}
+		id := string(c[0:4])
+		size := int64(binary.LittleEndian.Uint32(c[4:8]))
+		padded := size + size%2
+		switch id {
+		case "LIST", "id3 ", "ID3 ":
+			body := make([]byte, padded)
+			n, _ := io.ReadFull(r, body)
+			if int64(n) < size {
+				return chunks
+			}
+			chunks = append(chunks, &wavChunk{id: id, data: body[:size]})
+		default:
+			if _, err := io.CopyN(io.Discard, r, padded); err != nil {
+				return chunks
+			}
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package netmd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// testID3 returns an id3 tag of version (2, 3 or 4) with a text frame for every id and value pair
+func testID3(magic string, version byte, frames ...string) []byte {
+	var body []byte
+	for i := 0; i+1 < len(frames); i += 2 {
+		text := []byte(frames[i+1])
+		switch version {
+		case 2:
+			n := len(text)
+			body = append(body, frames[i]...)
+			body = append(body, byte(n>>16), byte(n>>8), byte(n))
+		case 3:
+			body = append(body, frames[i]...)
+			body = append(body, 0, 0, 0, 0, 0, 0)
+			binary.BigEndian.PutUint32(body[len(body)-6:], uint32(len(text)))
+		default:
+			body = append(body, frames[i]...)
+			body = append(body, testSyncSafe(len(text))...)
+			body = append(body, 0, 0)
+		}
+		body = append(body, text...)
+	}
+	body = append(body, make([]byte, 10)...) // padding
+	tag := append([]byte(magic), version, 0x00, 0x00)
+	tag = append(tag, testSyncSafe(len(body))...)
+	return append(tag, body...)
+}
+
+func testSyncSafe(n int) []byte {
+	return []byte{byte(n>>21) & 0x7f, byte(n>>14) & 0x7f, byte(n>>7) & 0x7f, byte(n) & 0x7f}
+}
+
+func TestParseInfoList(t *testing.T) {
+	b := []byte("INFO")
+	b = append(b, testChunk("IART", []byte("Artist\x00"))...)
+	b = append(b, testChunk("ICMT", []byte("odd"))...)
+	b = append(b, testChunk("INAM", []byte(" Title \x00\x00"))...)
+	b = append(b, testChunk("IPRD", []byte("Album"))...)
+	if m := parseInfoList(b); *m != (Metadata{Title: "Title", Artist: "Artist", Album: "Album"}) {
+		t.Fatalf("metadata %+v", m)
+	}
+	if m := parseInfoList(append([]byte("adtl"), b[4:]...)); *m != (Metadata{}) {
+		t.Fatalf("metadata of a LIST that is no INFO %+v", m)
+	}
+	if m := parseInfoList(b[:len(b)-3]); *m != (Metadata{Title: "Title", Artist: "Artist", Album: "Alb"}) {
+		t.Fatalf("metadata of a truncated list %+v", m)
+	}
+}
+
+func TestParseID3(t *testing.T) {
+	tests := []struct {
+		name string
+		tag  []byte
+		want Metadata
+	}{
+		{"v2.2", testID3("ID3", 2, "TT2", "\x00Title", "TP1", "\x00Artist", "TAL", "\x00Album"), Metadata{"Title", "Artist", "Album"}},
+		{"v2.3 iso-8859-1", testID3("ID3", 3, "TIT2", "\x00Caf\xe9", "TPE1", "\x00Artist\x00"), Metadata{Title: "Café", Artist: "Artist"}},
+		{"v2.3 utf-16 with bom", testID3("ID3", 3, "TIT2", "\x01\xff\xfeT\x00i\x00\x00\x00"), Metadata{Title: "Ti"}},
+		{"v2.4 utf-16be", testID3("ID3", 4, "TALB", "\x02\x00A\x00b"), Metadata{Album: "Ab"}},
+		{"v2.4 utf-8", testID3("ID3", 4, "TIT2", "\x03Caf\xc3\xa9", "TXXX", "\x03other"), Metadata{Title: "Café"}},
+		{"ea3", testID3("ea3", 3, "TIT2", "\x00Title"), Metadata{Title: "Title"}},
+		{"not id3", []byte("XYZ\x03\x00\x00\x00\x00\x00\x00"), Metadata{}},
+		{"frame larger than the tag", testID3("ID3", 3, "TIT2", "\x00Title")[:20], Metadata{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if m := parseID3(tt.tag); *m != tt.want {
+				t.Fatalf("metadata %+v, want %+v", m, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewMetadata(t *testing.T) {
+	info := append([]byte("INFO"), testChunk("INAM", []byte("Info title"))...)
+	info = append(info, testChunk("IART", []byte("Info artist"))...)
+	chunks := []*wavChunk{
+		{id: "id3 ", data: testID3("ID3", 3, "TIT2", "\x00Id3 title")},
+		{id: "LIST", data: info},
+	}
+	if m := newMetadata(chunks); *m != (Metadata{Title: "Id3 title", Artist: "Info artist"}) {
+		t.Fatalf("metadata %+v", m)
+	}
+}
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		template string
+		m        Metadata
+		want     string
+	}{
+		{"{artist} - {title}", Metadata{Title: "Title", Artist: "Artist"}, "Artist - Title"},
+		{"{artist} - {title}", Metadata{Title: "Title"}, "Title"},
+		{"{artist} - {title}", Metadata{Artist: "Artist"}, "Artist"},
+		{"{album}/{artist} - {title}", Metadata{Album: "Album", Title: "Title"}, "Album/Title"},
+		{"[{album}] {title}", Metadata{Title: "Title"}, "[] Title"},
+		{"{title} {unknown}", Metadata{Title: " Title "}, " Title  {unknown}"},
+		{"{title", Metadata{Title: "Title"}, "{title"},
+	}
+	for _, tt := range tests {
+		if got := tt.m.Format(tt.template); got != tt.want {
+			t.Errorf("%q with %+v formatted %q, want %q", tt.template, tt.m, got, tt.want)
+		}
+	}
+}
+
+func TestTitleTemplate(t *testing.T) {
+	info := append([]byte("INFO"), testChunk("INAM", []byte("Tagged"))...)
+	info = append(info, testChunk("IART", []byte("Artist"))...)
+	w := testRiff(testChunk("fmt ", testFmt(waveFormatPCM, 2)), testChunk("LIST", info), testChunk("data", make([]byte, 8)))
+
+	md := NewNetMDWithTransport(NewEmulator(), false)
+	for _, tt := range []struct {
+		template string
+		title    string
+		want     string
+	}{
+		{"", "", "Tagged"},
+		{"{artist} - {title}", "", "Artist - Tagged"},
+		{"{artist} - {title}", "Given", "Given"},
+	} {
+		md.SetTitleTemplate(tt.template)
+		trk, err := md.NewTrackFromReader(tt.title, bytes.NewReader(w), int64(len(w)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if trk.Title != tt.want {
+			t.Errorf("template %q and title %q made %q, want %q", tt.template, tt.title, trk.Title, tt.want)
+		}
+	}
+}
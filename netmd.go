@@ -2,19 +2,19 @@ package netmd
 
 import (
 	"bytes"
+	"context"
 	"errors"
-	"github.com/enimatek-nl/gousb"
 	"log"
 	"time"
 )
 
 type NetMD struct {
-	debug bool
-	index int
-	devs  []*gousb.Device
-	ctx   *gousb.Context
-	out   *gousb.OutEndpoint
-	ekb   *EKB
+	debug         bool
+	transport     Transport
+	ekb           *EKB
+	titleTemplate string
+	command       chan struct{} // held while a command waits for its reply, serializes concurrent callers like Watch
+	session       chan struct{} // held during a whole secure session (send or download), Watch waits for it
 }
 
 type Encoding byte
@@ -25,6 +25,8 @@ type Control byte
 
 type TrackProt byte
 
+type OperatingStatus uint16
+
 const (
 	EncSP  Encoding = 0x90
 	EncLP2 Encoding = 0x92
@@ -40,73 +42,63 @@ const (
 
 	TrackProtected   TrackProt = 0x03
 	TrackUnprotected TrackProt = 0x00
+
+	// operating status codes as listed in the OperatingStatus enum of netmd-js, it has none for recording
+	OpReady       OperatingStatus = 0xc5ff // stopped
+	OpPlaying     OperatingStatus = 0xc375
+	OpPaused      OperatingStatus = 0xc37d
+	OpFastForward OperatingStatus = 0xc33f
+	OpRewind      OperatingStatus = 0xc34f
+	OpReadingTOC  OperatingStatus = 0xff23
+	OpNoDisc      OperatingStatus = 0xff10
+	OpDiscBlank   OperatingStatus = 0xffff
 )
 
 var (
 	ByteArr16 = []byte{0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}
+
+	pollInterval = time.Millisecond * 100 // between the polls for a reply, a command gives up after 300 of them
 )
 
+// NewNetMD opens the compatible usb device found at index
 func NewNetMD(index int, debug bool) (md *NetMD, err error) {
-	md = &NetMD{
-		index: index,
-		debug: debug,
-		ekb:   NewEKB(),
-	}
-
-	md.ctx = gousb.NewContext()
-	md.devs, err = md.ctx.OpenDevices(func(desc *gousb.DeviceDesc) bool {
-		for _, d := range Devices {
-			if d.deviceId == desc.Product && d.vendorId == desc.Vendor {
-				if md.debug {
-					log.Printf("Found %s", d.name)
-				}
-				return true
-			}
-		}
-		return false
-	})
-
+	t, err := newUsbTransport(index, debug)
 	if err != nil {
 		return
 	}
+	md = NewNetMDWithTransport(t, debug)
+	return
+}
 
-	if len(md.devs) == 0 || len(md.devs) <= md.index {
-		err = errors.New("no compatible netmd device found or incorrect index")
-		return
-	}
-
-	for num := range md.devs[md.index].Desc.Configs {
-		config, _ := md.devs[md.index].Config(num)
-		for _, desc := range config.Desc.Interfaces {
-			intf, _ := config.Interface(desc.Number, 0)
-			for _, endpointDesc := range intf.Setting.Endpoints {
-				if endpointDesc.Direction == gousb.EndpointDirectionOut {
-					if md.out, err = intf.OutEndpoint(endpointDesc.Number); err != nil {
-						return
-					}
-					if md.debug {
-						log.Printf("%s", endpointDesc)
-					}
-				}
-			}
-			config.Close()
-		}
+// NewNetMDWithTransport uses the given Transport to talk to the NetMD instead of the default usb connection
+func NewNetMDWithTransport(t Transport, debug bool) *NetMD {
+	return &NetMD{
+		debug:     debug,
+		transport: t,
+		ekb:       NewEKB(),
+		command:   make(chan struct{}, 1),
+		session:   make(chan struct{}, 1),
 	}
-	return
 }
 
 func (md *NetMD) Close() {
-	for _, d := range md.devs {
-		d.Close()
-	}
-	md.ctx.Close()
+	md.transport.Close()
 }
 
 // Wait makes sure the device is truly finished, needed to prevent crashes on the SHARP IM-DR410/IM-DR420 and the Sony MZ-N420D
 func (md *NetMD) Wait() error {
+	return md.WaitContext(context.Background())
+}
+
+// WaitContext is Wait with a ctx to cancel the call or set a deadline
+func (md *NetMD) WaitContext(ctx context.Context) error {
 	buf := make([]byte, 4)
 	for i := 0; i < 10; i++ {
-		c, err := md.devs[md.index].Control(gousb.ControlIn|gousb.ControlVendor|gousb.ControlInterface, 0x01, 0, 0, buf)
+		if err := md.lockCommand(ctx); err != nil {
+			return err
+		}
+		c, err := md.transport.Poll(buf)
+		md.unlockCommand()
 		if err != nil {
 			return err
 		}
@@ -119,27 +111,45 @@ func (md *NetMD) Wait() error {
 				return nil
 			}
 		}
-		time.Sleep(time.Millisecond * 100)
+		if err := sleep(ctx, pollInterval); err != nil {
+			return err
+		}
 	}
-	return errors.New("no sync response")
+	return &TimeoutError{Command: []byte{0x01}, Tries: 10}
 }
 
 // RequestDiscCapacity returns the totals in seconds
 func (md *NetMD) RequestDiscCapacity() (recorded uint64, total uint64, available uint64, err error) {
-	r, err := md.submit(ControlAccepted, []byte{0x18, 0x06, 0x02, 0x10, 0x10, 0x00}, []byte{0x30, 0x80, 0x03, 0x00, 0xff, 0x00, 0x00, 0x00, 0x00, 0x00})
+	return md.RequestDiscCapacityContext(context.Background())
+}
+
+// RequestDiscCapacityContext is RequestDiscCapacity with a ctx to cancel the call or set a deadline
+func (md *NetMD) RequestDiscCapacityContext(ctx context.Context) (recorded uint64, total uint64, available uint64, err error) {
+	r, err := md.submit(ctx, ControlAccepted, []byte{0x18, 0x06, 0x02, 0x10, 0x10, 0x00}, []byte{0x30, 0x80, 0x03, 0x00, 0xff, 0x00, 0x00, 0x00, 0x00, 0x00})
 	if err != nil {
 		return
 	}
-	recorded = (hexToInt(r[29]) * 3600) + (hexToInt(r[30]) * 60) + hexToInt(r[31])
-	total = (hexToInt(r[35]) * 3600) + (hexToInt(r[36]) * 60) + hexToInt(r[37])
-	available = (hexToInt(r[42]) * 3600) + (hexToInt(r[43]) * 60) + hexToInt(r[44])
+	if err = expect(r, 45); err != nil {
+		return
+	}
+	if recorded, err = bcdToSeconds(r[28:31]); err != nil {
+		return
+	}
+	if total, err = bcdToSeconds(r[35:38]); err != nil {
+		return
+	}
+	available, err = bcdToSeconds(r[42:45])
 	return
 }
 
 // SetDiscHeader will write  a raw title to the disc
 func (md *NetMD) SetDiscHeader(t string) error {
-	md.poll()
-	o, err := md.RequestDiscHeader()
+	return md.SetDiscHeaderContext(context.Background(), t)
+}
+
+// SetDiscHeaderContext is SetDiscHeader with a ctx to cancel the call or set a deadline
+func (md *NetMD) SetDiscHeaderContext(ctx context.Context, t string) error {
+	o, err := md.RequestDiscHeaderContext(ctx)
 	if err != nil {
 		return err
 	}
@@ -150,11 +160,13 @@ func (md *NetMD) SetDiscHeader(t string) error {
 	c = append(c, 0x00, 0x00)
 	c = append(c, intToHex16(int16(j))...)
 	c = append(c, []byte(t)...)
-	_, err = md.submit(ControlAccepted, []byte{0x18, 0x08, 0x10, 0x18, 0x01, 0x01}, []byte{0x00})
-	_, err = md.submit(ControlAccepted, []byte{0x18, 0x08, 0x10, 0x18, 0x01, 0x00}, []byte{0x00})
-	_, err = md.submit(ControlAccepted, []byte{0x18, 0x08, 0x10, 0x18, 0x01, 0x03}, []byte{0x00})
-	_, err = md.submit(ControlAccepted, []byte{0x18, 0x07, 0x02, 0x20, 0x18, 0x01}, c) // actual call
-	_, err = md.submit(ControlAccepted, []byte{0x18, 0x08, 0x10, 0x18, 0x01, 0x00}, []byte{0x00})
+	_, err = md.submit(ctx, ControlAccepted, []byte{0x18, 0x08, 0x10, 0x18, 0x01, 0x01}, []byte{0x00})
+	_, err = md.submit(ctx, ControlAccepted, []byte{0x18, 0x08, 0x10, 0x18, 0x01, 0x00}, []byte{0x00})
+	_, err = md.submit(ctx, ControlAccepted, []byte{0x18, 0x08, 0x10, 0x18, 0x01, 0x03}, []byte{0x00})
+	_, err = md.submit(ctx, ControlAccepted, []byte{0x18, 0x07, 0x02, 0x20, 0x18, 0x01}, c) // actual call
+	if _, cerr := md.submit(ctx, ControlAccepted, []byte{0x18, 0x08, 0x10, 0x18, 0x01, 0x00}, []byte{0x00}); err == nil {
+		err = cerr
+	}
 	if err != nil {
 		return err
 	}
@@ -163,28 +175,49 @@ func (md *NetMD) SetDiscHeader(t string) error {
 
 // RequestDiscHeader returns the raw title of the disc
 func (md *NetMD) RequestDiscHeader() (string, error) {
-	r, err := md.submit(ControlAccepted, []byte{0x18, 0x06, 0x02, 0x20, 0x18, 0x01}, []byte{0x00, 0x00, 0x30, 0x00, 0x0a, 0x00, 0xff, 0x00, 0x00, 0x00, 0x00, 0x00})
+	return md.RequestDiscHeaderContext(context.Background())
+}
+
+// RequestDiscHeaderContext is RequestDiscHeader with a ctx to cancel the call or set a deadline
+func (md *NetMD) RequestDiscHeaderContext(ctx context.Context) (string, error) {
+	r, err := md.submit(ctx, ControlAccepted, []byte{0x18, 0x06, 0x02, 0x20, 0x18, 0x01}, []byte{0x00, 0x00, 0x30, 0x00, 0x0a, 0x00, 0xff, 0x00, 0x00, 0x00, 0x00, 0x00})
 	if err != nil {
 		return "", err
 	}
+	if err = expect(r, 25); err != nil {
+		return "", err
+	}
 	return string(r[25:]), nil
 }
 
 // RecordingParameters current default recording parameters set on the NetMD
 func (md *NetMD) RecordingParameters() (encoding Encoding, channels Channels, err error) {
-	r, err := md.submit(ControlAccepted, []byte{0x18, 0x09, 0x80, 0x01, 0x03, 0x30}, []byte{0x88, 0x01, 0x00, 0x30, 0x88, 0x05, 0x00, 0x30, 0x88, 0x07, 0x00, 0xff, 0x00, 0x00, 0x00, 0x00, 0x00})
+	return md.RecordingParametersContext(context.Background())
+}
+
+// RecordingParametersContext is RecordingParameters with a ctx to cancel the call or set a deadline
+func (md *NetMD) RecordingParametersContext(ctx context.Context) (encoding Encoding, channels Channels, err error) {
+	r, err := md.submit(ctx, ControlAccepted, []byte{0x18, 0x09, 0x80, 0x01, 0x03, 0x30}, []byte{0x88, 0x01, 0x00, 0x30, 0x88, 0x05, 0x00, 0x30, 0x88, 0x07, 0x00, 0xff, 0x00, 0x00, 0x00, 0x00, 0x00})
 	if err != nil {
 		return
 	}
+	if err = expect(r, 36); err != nil {
+		return
+	}
 	encoding = Encoding(r[34])
 	channels = Channels(r[35])
 	return
 }
 
-// RequestStatus returns known status flags
+// RequestStatus returns known status flags, RequestDeviceStatus decodes all of them
 func (md *NetMD) RequestStatus() (disk bool, err error) {
+	return md.RequestStatusContext(context.Background())
+}
+
+// RequestStatusContext is RequestStatus with a ctx to cancel the call or set a deadline
+func (md *NetMD) RequestStatusContext(ctx context.Context) (disk bool, err error) {
 	//_, err = md.rawCall([]byte{0x00, 0x18, 0x08, 0x80, 0x00, 0x01}, []byte{0x00})
-	r, err := md.submit(ControlAccepted, []byte{0x18, 0x09, 0x80, 0x01, 0x02, 0x30}, []byte{0x88, 0x00, 0x00, 0x30, 0x88, 0x04, 0x00, 0xff, 0x00, 0x00, 0x00, 0x00, 0x00})
+	r, err := md.requestStatus(ctx)
 	if err != nil {
 		return
 	}
@@ -192,31 +225,69 @@ func (md *NetMD) RequestStatus() (disk bool, err error) {
 	return
 }
 
+// RequestOperatingStatus returns what the device is doing, eg. OpPlaying or OpReadingTOC
+func (md *NetMD) RequestOperatingStatus() (OperatingStatus, error) {
+	return md.RequestOperatingStatusContext(context.Background())
+}
+
+// RequestOperatingStatusContext is RequestOperatingStatus with a ctx to cancel the call or set a deadline
+func (md *NetMD) RequestOperatingStatusContext(ctx context.Context) (OperatingStatus, error) {
+	r, err := md.submit(ctx, ControlAccepted, []byte{0x18, 0x09, 0x80, 0x01, 0x03, 0x30}, []byte{0x88, 0x02, 0x00, 0x30, 0x88, 0x05, 0x00, 0x30, 0x88, 0x06, 0x00, 0xff, 0x00, 0x00, 0x00, 0x00, 0x00})
+	if err != nil {
+		return 0, err
+	}
+	if err = expect(r, 32); err != nil {
+		return 0, err
+	}
+	return OperatingStatus(hexToInt16(r[30:32])), nil
+}
+
 func (md *NetMD) RequestTrackCount() (c int, err error) {
-	_, err = md.submit(ControlAccepted, []byte{0x18, 0x08, 0x10, 0x10, 0x01, 0x01}, []byte{0x00})
-	r, err := md.submit(ControlAccepted, []byte{0x18, 0x06, 0x02, 0x10, 0x10, 0x01}, []byte{0x30, 0x00, 0x10, 0x00, 0xff, 0x00, 0x00, 0x00, 0x00, 0x00})
+	return md.RequestTrackCountContext(context.Background())
+}
+
+// RequestTrackCountContext is RequestTrackCount with a ctx to cancel the call or set a deadline
+func (md *NetMD) RequestTrackCountContext(ctx context.Context) (c int, err error) {
+	_, err = md.submit(ctx, ControlAccepted, []byte{0x18, 0x08, 0x10, 0x10, 0x01, 0x01}, []byte{0x00})
+	r, err := md.submit(ctx, ControlAccepted, []byte{0x18, 0x06, 0x02, 0x10, 0x10, 0x01}, []byte{0x30, 0x00, 0x10, 0x00, 0xff, 0x00, 0x00, 0x00, 0x00, 0x00})
 	if err != nil {
 		return
 	}
+	if err = expect(r, 25); err != nil {
+		return
+	}
 	c = int(hexToInt16(r[23:]))
 	return
 }
 
 // RequestTrackTitle returns the raw title of the trk number starting from 0
 func (md *NetMD) RequestTrackTitle(trk int) (t string, err error) {
-	r, err := md.submit(ControlAccepted, []byte{0x18, 0x06, 0x02, 0x20, 0x18, byte(2) & 0xff}, []byte{0x00, byte(trk) & 0xff, 0x30, 0x00, 0x0a, 0x00, 0xff, 0x00, 0x00, 0x00, 0x00, 0x00})
+	return md.RequestTrackTitleContext(context.Background(), trk)
+}
+
+// RequestTrackTitleContext is RequestTrackTitle with a ctx to cancel the call or set a deadline
+func (md *NetMD) RequestTrackTitleContext(ctx context.Context, trk int) (t string, err error) {
+	r, err := md.submit(ctx, ControlAccepted, []byte{0x18, 0x06, 0x02, 0x20, 0x18, byte(2) & 0xff}, []byte{0x00, byte(trk) & 0xff, 0x30, 0x00, 0x0a, 0x00, 0xff, 0x00, 0x00, 0x00, 0x00, 0x00})
 	if err != nil {
 		return
 	}
+	if err = expect(r, 25); err != nil {
+		return
+	}
 	t = string(r[25:])
 	return
 }
 
 // SetTrackTitle set the title of the trk number starting from 0, isNew can be be true if it's a newadded track
 func (md *NetMD) SetTrackTitle(trk int, t string, isNew bool) (err error) {
+	return md.SetTrackTitleContext(context.Background(), trk, t, isNew)
+}
+
+// SetTrackTitleContext is SetTrackTitle with a ctx to cancel the call or set a deadline
+func (md *NetMD) SetTrackTitleContext(ctx context.Context, trk int, t string, isNew bool) (err error) {
 	j := 0
 	if !isNew {
-		o, err := md.RequestTrackTitle(trk)
+		o, err := md.RequestTrackTitleContext(ctx, trk)
 		if err != nil {
 			return err
 		}
@@ -230,14 +301,17 @@ func (md *NetMD) SetTrackTitle(trk int, t string, isNew bool) (err error) {
 	s = append(s, []byte(t)...)
 
 	if !isNew {
-		_, err = md.submit(ControlAccepted, []byte{0x18, 0x08, 0x10, 0x18, 0x02, 0x00}, []byte{0x00})
-		_, err = md.submit(ControlAccepted, []byte{0x18, 0x08, 0x10, 0x18, 0x02, 0x03}, []byte{0x00})
+		_, err = md.submit(ctx, ControlAccepted, []byte{0x18, 0x08, 0x10, 0x18, 0x02, 0x00}, []byte{0x00})
+		_, err = md.submit(ctx, ControlAccepted, []byte{0x18, 0x08, 0x10, 0x18, 0x02, 0x03}, []byte{0x00})
 	}
 
-	_, err = md.submit(ControlAccepted, []byte{0x18, 0x07, 0x02, 0x20, 0x18, byte(2) & 0xff}, s)
+	_, err = md.submit(ctx, ControlAccepted, []byte{0x18, 0x07, 0x02, 0x20, 0x18, byte(2) & 0xff}, s)
 
 	if !isNew {
-		_, err = md.submit(ControlAccepted, []byte{0x18, 0x08, 0x10, 0x18, 0x02, 0x00}, []byte{0x00})
+		// the descriptor is closed also when the title was rejected, eg. on a write protected disc
+		if _, cerr := md.submit(ctx, ControlAccepted, []byte{0x18, 0x08, 0x10, 0x18, 0x02, 0x00}, []byte{0x00}); err == nil {
+			err = cerr
+		}
 	}
 
 	if err != nil {
@@ -246,23 +320,114 @@ func (md *NetMD) SetTrackTitle(trk int, t string, isNew bool) (err error) {
 	return
 }
 
-//
+// RequestTrackFlag returns the TrackProt flag of the trk starting from 0
 func (md *NetMD) RequestTrackFlag(trk int) (flag TrackProt, err error) {
+	return md.RequestTrackFlagContext(context.Background(), trk)
+}
+
+// RequestTrackFlagContext is RequestTrackFlag with a ctx to cancel the call or set a deadline
+func (md *NetMD) RequestTrackFlagContext(ctx context.Context, trk int) (flag TrackProt, err error) {
 	s := []byte{0x01, 0x20, 0x10, 0x01}
 	s = append(s, intToHex16(int16(trk))...)
 	s = append(s, 0xff, 0x00, 0x00, 0x01, 0x00, 0x08)
-	d, err := md.submit(ControlAccepted, []byte{0x18, 0x06}, s)
+	d, err := md.submit(ctx, ControlAccepted, []byte{0x18, 0x06}, s)
 	if err != nil {
 		return
 	}
+	if err = expect(d, 16); err != nil {
+		return
+	}
 	return TrackProt(d[15]), nil
 }
 
-// EraseTrack will erase the trk number starting from 0
+// EraseTrack will erase the trk number starting from 0, a TrackProtected track is refused with a ProtectedError
 func (md *NetMD) EraseTrack(trk int) error {
+	return md.EraseTrackContext(context.Background(), trk)
+}
+
+// EraseTrackContext is EraseTrack with a ctx to cancel the call or set a deadline
+func (md *NetMD) EraseTrackContext(ctx context.Context, trk int) error {
+	if err := md.checkProtection(ctx, trk); err != nil {
+		return err
+	}
+	return md.ForceEraseTrackContext(ctx, trk)
+}
+
+// ForceEraseTrack will erase the trk number starting from 0 also when it is protected
+func (md *NetMD) ForceEraseTrack(trk int) error {
+	return md.ForceEraseTrackContext(context.Background(), trk)
+}
+
+// ForceEraseTrackContext is ForceEraseTrack with a ctx to cancel the call or set a deadline
+func (md *NetMD) ForceEraseTrackContext(ctx context.Context, trk int) error {
 	s := []byte{0xff, 0x01, 0x00, 0x20, 0x10, 0x01}
 	s = append(s, intToHex16(int16(trk))...)
-	_, err := md.submit(ControlAccepted, []byte{0x18, 0x40}, s)
+	_, err := md.submit(ctx, ControlAccepted, []byte{0x18, 0x40}, s)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// EraseDisc will erase every track, the disc header and the groups in one command, it is refused with a ProtectedError
+// when a track is protected. To find those it first queries the flag of every track, ForceEraseDisc skips that and only
+// sends the erase command
+func (md *NetMD) EraseDisc() error {
+	return md.EraseDiscContext(context.Background())
+}
+
+// EraseDiscContext is EraseDisc with a ctx to cancel the call or set a deadline
+func (md *NetMD) EraseDiscContext(ctx context.Context) error {
+	c, err := md.RequestTrackCountContext(ctx)
+	if err != nil {
+		return err
+	}
+	for trk := 0; trk < c; trk++ {
+		if err = md.checkProtection(ctx, trk); err != nil {
+			return err
+		}
+	}
+	return md.ForceEraseDiscContext(ctx)
+}
+
+// ForceEraseDisc will erase the whole disc also when tracks are protected
+func (md *NetMD) ForceEraseDisc() error {
+	return md.ForceEraseDiscContext(context.Background())
+}
+
+// ForceEraseDiscContext is ForceEraseDisc with a ctx to cancel the call or set a deadline
+func (md *NetMD) ForceEraseDiscContext(ctx context.Context) error {
+	_, err := md.submit(ctx, ControlAccepted, []byte{0x18, 0x40}, []byte{0xff, 0x00, 0x00})
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// checkProtection returns a ProtectedError when trk is protected, devices that stub or reject the flag query have no
+// protected tracks as far as we can tell
+func (md *NetMD) checkProtection(ctx context.Context, trk int) error {
+	flag, err := md.RequestTrackFlagContext(ctx, trk)
+	if errors.Is(err, ErrNotImplemented) || errors.Is(err, ErrRejected) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if flag == TrackProtected {
+		return &ProtectedError{Track: trk}
+	}
+	return nil
+}
+
+// EjectDisc will eject the disc, not every device supports this
+func (md *NetMD) EjectDisc() error {
+	return md.EjectDiscContext(context.Background())
+}
+
+// EjectDiscContext is EjectDisc with a ctx to cancel the call or set a deadline
+func (md *NetMD) EjectDiscContext(ctx context.Context) error {
+	_, err := md.submit(ctx, ControlAccepted, []byte{0x18, 0xc1}, []byte{0xff, 0x60, 0x00})
 	if err != nil {
 		return err
 	}
@@ -271,12 +436,17 @@ func (md *NetMD) EraseTrack(trk int) error {
 
 // MoveTrack will move the trk number to a new position
 func (md *NetMD) MoveTrack(trk, to int) error {
+	return md.MoveTrackContext(context.Background(), trk, to)
+}
+
+// MoveTrackContext is MoveTrack with a ctx to cancel the call or set a deadline
+func (md *NetMD) MoveTrackContext(ctx context.Context, trk, to int) error {
 	s := []byte{0xff, 0x00, 0x00, 0x20, 0x10, 0x01}
 	s = append(s, intToHex16(int16(trk))...)
 	s = append(s, 0x20, 0x10, 0x01)
 	s = append(s, intToHex16(int16(to))...)
-	_, err := md.submit(ControlAccepted, []byte{0x18, 0x08, 0x10, 0x10, 0x01, 0x00}, []byte{0x00})
-	_, err = md.submit(ControlAccepted, []byte{0x18, 0x43}, s)
+	_, err := md.submit(ctx, ControlAccepted, []byte{0x18, 0x08, 0x10, 0x10, 0x01, 0x00}, []byte{0x00})
+	_, err = md.submit(ctx, ControlAccepted, []byte{0x18, 0x43}, s)
 	if err != nil {
 		return err
 	}
@@ -285,100 +455,212 @@ func (md *NetMD) MoveTrack(trk, to int) error {
 
 // RequestTrackLength returns the duration in seconds of the trk starting from 0
 func (md *NetMD) RequestTrackLength(trk int) (duration uint64, err error) {
+	return md.RequestTrackLengthContext(context.Background(), trk)
+}
+
+// RequestTrackLengthContext is RequestTrackLength with a ctx to cancel the call or set a deadline
+func (md *NetMD) RequestTrackLengthContext(ctx context.Context, trk int) (duration uint64, err error) {
 	s := []byte{0x02, 0x20, 0x10, 0x01}
 	s = append(s, intToHex16(int16(trk))...)
 	s = append(s, 0x30, 0x00, 0x01, 0x00, 0xff, 0x00, 0x00, 0x00, 0x00, 0x00)
-	r, err := md.submit(ControlAccepted, []byte{0x18, 0x06}, s)
+	r, err := md.submit(ctx, ControlAccepted, []byte{0x18, 0x06}, s)
 	if err != nil {
 		return
 	}
-	duration = (hexToInt(r[27]) * 3600) + (hexToInt(r[28]) * 60) + hexToInt(r[29])
-	return
+	if err = expect(r, 30); err != nil {
+		return
+	}
+	return bcdToSeconds(r[27:30])
 }
 
 // RequestTrackEncoding returns the Encoding of the trk starting from 0
 func (md *NetMD) RequestTrackEncoding(trk int) (encoding Encoding, err error) {
+	return md.RequestTrackEncodingContext(context.Background(), trk)
+}
+
+// RequestTrackEncodingContext is RequestTrackEncoding with a ctx to cancel the call or set a deadline
+func (md *NetMD) RequestTrackEncodingContext(ctx context.Context, trk int) (encoding Encoding, err error) {
+	encoding, _, err = md.requestTrackEncoding(ctx, trk)
+	return
+}
+
+// requestTrackEncoding returns the Encoding and Channels of the trk starting from 0
+func (md *NetMD) requestTrackEncoding(ctx context.Context, trk int) (encoding Encoding, channels Channels, err error) {
 	s := append(intToHex16(int16(trk)), 0x30, 0x80, 0x07, 0x00, 0xff, 0x00, 0x00, 0x00, 0x00, 0x00)
-	r, err := md.submit(ControlAccepted, []byte{0x18, 0x06, 0x02, 0x20, 0x10, 0x01}, s)
+	r, err := md.submit(ctx, ControlAccepted, []byte{0x18, 0x06, 0x02, 0x20, 0x10, 0x01}, s)
 	if err != nil {
 		return
 	}
-	return Encoding(r[len(r)-2]), nil
+	if err = expect(r, 9); err != nil {
+		return
+	}
+	return Encoding(r[len(r)-2]), Channels(r[len(r)-1]), nil
+}
+
+// lockSession waits until no secure session is running and takes it
+func (md *NetMD) lockSession(ctx context.Context) error {
+	select {
+	case md.session <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// unlockSession releases the session taken by lockSession
+func (md *NetMD) unlockSession() {
+	<-md.session
+}
+
+// lockCommand waits until no other command is waiting for its reply and takes the Transport, it gives up when ctx is done
+func (md *NetMD) lockCommand(ctx context.Context) error {
+	select {
+	case md.command <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// unlockCommand releases the Transport taken by lockCommand
+func (md *NetMD) unlockCommand() {
+	<-md.command
 }
 
 // submit will submit the `check + payload` wait for replies matching the `check` and `control`
-func (md *NetMD) submit(control Control, check []byte, payload []byte) ([]byte, error) {
+func (md *NetMD) submit(ctx context.Context, control Control, check []byte, payload []byte) ([]byte, error) {
 	i := []byte{0x00}
 	i = append(i, check...)
 	i = append(i, payload...)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := md.lockCommand(ctx); err != nil {
+		return nil, err
+	}
+	defer md.unlockCommand()
 	md.poll()
 	if md.debug {
 		log.Printf("<- sending data: % x", i)
 	}
-	if _, err := md.devs[md.index].Control(gousb.ControlOut|gousb.ControlVendor|gousb.ControlInterface, 0x80, 0, 0, i); err != nil {
+	if _, err := md.transport.ControlOut(0x80, i); err != nil {
 		return nil, err
 	}
-	return md.receive(control, check, nil)
+	r, err := md.receive(ctx, control, check)
+	switch e := err.(type) {
+	case *RejectedError:
+		e.Command = i
+	case *NotImplementedError:
+		e.Command = i
+	case *TimeoutError:
+		e.Command = i
+	}
+	return r, err
 }
 
-func (md *NetMD) receive(control Control, check []byte, c chan Transfer) ([]byte, error) {
-	for tries := 0; tries < 300; tries++ {
-		if c != nil {
-			c <- Transfer{
-				Type: TtPoll,
-			}
+// receive polls until a reply matches the `check` and `control`, the caller holds the command lock
+func (md *NetMD) receive(ctx context.Context, control Control, check []byte) ([]byte, error) {
+	tries := 300
+	for try := 0; try < tries; try++ {
+		if r, ok, err := md.reply(control, check); ok || err != nil {
+			return r, err
 		}
-		if h := md.poll(); h != -1 {
-			recv := make([]byte, h)
-			if _, err := md.devs[md.index].Control(gousb.ControlIn|gousb.ControlVendor|gousb.ControlInterface, 0x81, 0, 0, recv); err != nil {
-				return nil, err
+		if err := sleep(ctx, pollInterval); err != nil {
+			return nil, err
+		}
+	}
+	return nil, &TimeoutError{Command: check, Tries: tries}
+}
+
+// await is receive for the end of a secure transfer which can take minutes, the command lock is only held for every poll
+// round-trip and progress is called without it so a progress callback may use md
+func (md *NetMD) await(ctx context.Context, control Control, check []byte, progress func(Transfer)) ([]byte, error) {
+	tries := 300
+	for try := 0; try < tries; try++ {
+		if progress != nil {
+			progress(Transfer{Type: TtPoll})
+		}
+		if err := md.lockCommand(ctx); err != nil {
+			return nil, err
+		}
+		r, ok, err := md.reply(control, check)
+		md.unlockCommand()
+		if ok || err != nil {
+			return r, err
+		}
+		if err := sleep(ctx, pollInterval); err != nil {
+			return nil, err
+		}
+	}
+	return nil, &TimeoutError{Command: check, Tries: tries}
+}
+
+// reply reads a pending reply, ok is set when it matches the `check` and `control`
+func (md *NetMD) reply(control Control, check []byte) ([]byte, bool, error) {
+	if h := md.poll(); h != -1 {
+		recv := make([]byte, h)
+		if _, err := md.transport.ControlIn(0x81, recv); err != nil {
+			return nil, false, err
+		}
+		chkLen := len(check) + 1
+		if len(recv) < chkLen {
+			return nil, false, &ShortResponseError{Response: recv, Want: chkLen}
+		}
+		if bytes.Equal(recv[1:len(check)+1], check) {
+			ctrl := Control(recv[0])
+			if md.debug {
+				log.Printf("-> incoming data matched check: % x", recv[1:chkLen])
+				if ctrl == ControlAccepted || ctrl == ControlInterim {
+					log.Printf("-> payload: % x", recv[chkLen:])
+				}
 			}
-			chkLen := len(check) + 1
-			if bytes.Equal(recv[1:len(check)+1], check) {
-				ctrl := Control(recv[0])
-				if md.debug {
-					log.Printf("-> incoming data matched check: % x", recv[1:chkLen])
-					if ctrl == ControlAccepted || ctrl == ControlInterim {
-						log.Printf("-> payload: % x", recv[chkLen:])
-					}
+			switch ctrl {
+			case ControlAccepted:
+				if ctrl == control {
+					return recv, true, nil
+				} else if md.debug {
+					log.Printf("!! skipped accepted call: % x", recv[chkLen:])
 				}
-				switch ctrl {
-				case ControlAccepted:
-					if ctrl == control {
-						return recv, nil
-					} else if md.debug {
-						log.Printf("!! skipped accepted call: % x", recv[chkLen:])
-					}
-				case ControlInterim:
-					if ctrl == control {
-						return recv, nil
-					} else if md.debug {
-						log.Printf("?? skipped interim call: % x", recv[chkLen:])
-					}
-				case ControlRejected:
-					return nil, errors.New("!! submit was rejected")
-				case ControlStub:
-					if md.debug {
-						log.Printf("?? not implemented: % x", recv[chkLen:])
-					}
-					return recv, nil
+			case ControlInterim:
+				if ctrl == control {
+					return recv, true, nil
+				} else if md.debug {
+					log.Printf("?? skipped interim call: % x", recv[chkLen:])
 				}
-			} else {
+			case ControlRejected:
+				return nil, false, &RejectedError{Command: check, Response: recv}
+			case ControlStub:
 				if md.debug {
-					log.Printf("-> !! incoming data: % x did not match check: % x", recv[1:chkLen], check)
+					log.Printf("?? not implemented: % x", recv[chkLen:])
 				}
+				return recv, false, &NotImplementedError{Command: check, Response: recv}
+			}
+		} else {
+			if md.debug {
+				log.Printf("-> !! incoming data: % x did not match check: % x", recv[1:chkLen], check)
 			}
 		}
-		time.Sleep(time.Millisecond * 100)
 	}
-	return nil, errors.New("no data matched check, timed out")
+	return nil, false, nil
 }
 
 func (md *NetMD) poll() int {
 	buf := make([]byte, 4)
-	md.devs[md.index].Control(gousb.ControlIn|gousb.ControlVendor|gousb.ControlInterface, 0x01, 0, 0, buf)
+	md.transport.Poll(buf)
 	if buf[0] == 0x01 { //&& buf[1] == 0x81
 		return int(buf[2])
 	}
 	return -1
 }
+
+// sleep waits for d or returns early with the error of ctx when it is done
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,34 @@
+package netmd
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCommandCancel(t *testing.T) {
+	md := NewNetMDWithTransport(NewEmulator(), false)
+
+	// a command queued behind one that waits for its reply gives up when its ctx is done
+	if err := md.lockCommand(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := md.RequestTrackCountContext(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("queued command returned %v", err)
+	}
+	if err := md.WaitContext(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("queued wait returned %v", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("queued command was cancelled after %s", d)
+	}
+
+	md.unlockCommand()
+	if c, err := md.RequestTrackCount(); err != nil || c != 0 {
+		t.Fatalf("track count %d, %v after the lock was released", c, err)
+	}
+}
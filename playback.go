@@ -0,0 +1,172 @@
+package netmd
+
+import (
+	"context"
+	"fmt"
+)
+
+type playbackAction byte
+
+type trackDirection uint16
+
+const (
+	actionPlay        playbackAction = 0x75
+	actionPause       playbackAction = 0x7d
+	actionFastForward playbackAction = 0x39
+	actionRewind      playbackAction = 0x49
+
+	directionPrevious trackDirection = 0x0002
+	directionNext     trackDirection = 0x8001
+)
+
+// Play starts or resumes the playback
+func (md *NetMD) Play() error {
+	return md.PlayContext(context.Background())
+}
+
+// PlayContext is Play with a ctx to cancel the call or set a deadline
+func (md *NetMD) PlayContext(ctx context.Context) error {
+	return md.playbackControl(ctx, actionPlay)
+}
+
+// Pause pauses the playback, Play resumes it
+func (md *NetMD) Pause() error {
+	return md.PauseContext(context.Background())
+}
+
+// PauseContext is Pause with a ctx to cancel the call or set a deadline
+func (md *NetMD) PauseContext(ctx context.Context) error {
+	return md.playbackControl(ctx, actionPause)
+}
+
+// FastForward scans forward until Play, Pause or Stop is called
+func (md *NetMD) FastForward() error {
+	return md.FastForwardContext(context.Background())
+}
+
+// FastForwardContext is FastForward with a ctx to cancel the call or set a deadline
+func (md *NetMD) FastForwardContext(ctx context.Context) error {
+	return md.playbackControl(ctx, actionFastForward)
+}
+
+// Rewind scans backward until Play, Pause or Stop is called
+func (md *NetMD) Rewind() error {
+	return md.RewindContext(context.Background())
+}
+
+// RewindContext is Rewind with a ctx to cancel the call or set a deadline
+func (md *NetMD) RewindContext(ctx context.Context) error {
+	return md.playbackControl(ctx, actionRewind)
+}
+
+// Stop stops the playback
+func (md *NetMD) Stop() error {
+	return md.StopContext(context.Background())
+}
+
+// StopContext is Stop with a ctx to cancel the call or set a deadline
+func (md *NetMD) StopContext(ctx context.Context) error {
+	_, err := md.submit(ctx, ControlAccepted, []byte{0x18, 0xc5}, []byte{0xff, 0x00, 0x00, 0x00, 0x00})
+	return err
+}
+
+// Next skips to the next track
+func (md *NetMD) Next() error {
+	return md.NextContext(context.Background())
+}
+
+// NextContext is Next with a ctx to cancel the call or set a deadline
+func (md *NetMD) NextContext(ctx context.Context) error {
+	return md.trackChange(ctx, directionNext)
+}
+
+// Previous skips to the previous track
+func (md *NetMD) Previous() error {
+	return md.PreviousContext(context.Background())
+}
+
+// PreviousContext is Previous with a ctx to cancel the call or set a deadline
+func (md *NetMD) PreviousContext(ctx context.Context) error {
+	return md.trackChange(ctx, directionPrevious)
+}
+
+// Position is a place on the disc, a track starting from 0 and the time within it, Frame is a sound group of 512 samples
+type Position struct {
+	Track  int
+	Hour   int
+	Minute int
+	Second int
+	Frame  int
+}
+
+// Seconds returns the time within the track in whole seconds
+func (p Position) Seconds() uint64 {
+	return uint64(p.Hour*3600 + p.Minute*60 + p.Second)
+}
+
+// GotoTrack moves the playback to the start of the trk starting from 0
+func (md *NetMD) GotoTrack(trk int) error {
+	return md.GotoTrackContext(context.Background(), trk)
+}
+
+// GotoTrackContext is GotoTrack with a ctx to cancel the call or set a deadline
+func (md *NetMD) GotoTrackContext(ctx context.Context, trk int) error {
+	s := []byte{0xff, 0x01, 0x00, 0x00, 0x00, 0x00}
+	s = append(s, intToHex16(int16(trk))...)
+	_, err := md.submit(ctx, ControlAccepted, []byte{0x18, 0x50}, s)
+	return err
+}
+
+// GotoTime moves the playback to a time in the trk starting from 0, frame is a sound group of 512 samples (0-86)
+func (md *NetMD) GotoTime(trk int, h, m, s, frame int) error {
+	return md.GotoTimeContext(context.Background(), trk, h, m, s, frame)
+}
+
+// GotoTimeContext is GotoTime with a ctx to cancel the call or set a deadline
+func (md *NetMD) GotoTimeContext(ctx context.Context, trk int, h, m, s, frame int) error {
+	if h < 0 || h > 99 || m < 0 || m > 59 || s < 0 || s > 59 || frame < 0 || frame > 86 {
+		return fmt.Errorf("goto time: invalid time %d:%02d:%02d.%02d", h, m, s, frame)
+	}
+	d := []byte{0xff, 0x00, 0x00, 0x00, 0x00, 0x00}
+	d = append(d, intToHex16(int16(trk))...)
+	d = append(d, intToBcd(uint64(h)), intToBcd(uint64(m)), intToBcd(uint64(s)), intToBcd(uint64(frame)))
+	_, err := md.submit(ctx, ControlAccepted, []byte{0x18, 0x50}, d)
+	return err
+}
+
+// RequestPosition returns the track and time the playback is at
+func (md *NetMD) RequestPosition() (Position, error) {
+	return md.RequestPositionContext(context.Background())
+}
+
+// RequestPositionContext is RequestPosition with a ctx to cancel the call or set a deadline
+func (md *NetMD) RequestPositionContext(ctx context.Context) (p Position, err error) {
+	r, err := md.submit(ctx, ControlAccepted, []byte{0x18, 0x09, 0x80, 0x01, 0x04, 0x30}, []byte{0x88, 0x02, 0x00, 0x30, 0x88, 0x05, 0x00, 0x30, 0x00, 0x03, 0x00, 0x30, 0x00, 0x02, 0x00, 0xff, 0x00, 0x00, 0x00, 0x00, 0x00})
+	if err != nil {
+		return
+	}
+	if err = expect(r, 41); err != nil {
+		return
+	}
+	p.Track = int(hexToInt16(r[35:37]))
+	for i, v := range []*int{&p.Hour, &p.Minute, &p.Second, &p.Frame} {
+		d, err := bcdToInt(r[37+i])
+		if err != nil {
+			return Position{}, err
+		}
+		*v = int(d)
+	}
+	return
+}
+
+func (md *NetMD) playbackControl(ctx context.Context, action playbackAction) error {
+	_, err := md.submit(ctx, ControlAccepted, []byte{0x18, 0xc3}, []byte{0xff, byte(action), 0x00, 0x00, 0x00})
+	return err
+}
+
+func (md *NetMD) trackChange(ctx context.Context, direction trackDirection) error {
+	s := []byte{0xff, 0x10, 0x00, 0x00, 0x00, 0x00}
+	s = append(s, intToHex16(int16(direction))...)
+	_, err := md.submit(ctx, ControlAccepted, []byte{0x18, 0x50}, s)
+	return err
+}
@@ -0,0 +1,123 @@
+package netmd
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// commandTransport keeps the last command sent to the device
+type commandTransport struct {
+	Transport
+	last []byte
+}
+
+func (c *commandTransport) ControlOut(request uint8, data []byte) (int, error) {
+	c.last = append([]byte{}, data...)
+	return c.Transport.ControlOut(request, data)
+}
+
+func TestPlayback(t *testing.T) {
+	tests := []struct {
+		name    string
+		setup   func(emu *Emulator)
+		call    func(md *NetMD) error
+		command []byte
+		status  OperatingStatus
+		track   int
+	}{
+		{"play", nil, (*NetMD).Play, []byte{0x00, 0x18, 0xc3, 0xff, 0x75, 0x00, 0x00, 0x00}, OpPlaying, 0},
+		{"pause", nil, (*NetMD).Pause, []byte{0x00, 0x18, 0xc3, 0xff, 0x7d, 0x00, 0x00, 0x00}, OpPaused, 0},
+		{"fast forward", nil, (*NetMD).FastForward, []byte{0x00, 0x18, 0xc3, 0xff, 0x39, 0x00, 0x00, 0x00}, OpFastForward, 0},
+		{"rewind", nil, (*NetMD).Rewind, []byte{0x00, 0x18, 0xc3, 0xff, 0x49, 0x00, 0x00, 0x00}, OpRewind, 0},
+		{"stop", func(emu *Emulator) { emu.action = actionPlay }, (*NetMD).Stop,
+			[]byte{0x00, 0x18, 0xc5, 0xff, 0x00, 0x00, 0x00, 0x00}, OpReady, 0},
+		{"next", nil, (*NetMD).Next, []byte{0x00, 0x18, 0x50, 0xff, 0x10, 0x00, 0x00, 0x00, 0x00, 0x80, 0x01}, OpReady, 1},
+		{"next on the last track", func(emu *Emulator) { emu.seek(2, 0) }, (*NetMD).Next,
+			[]byte{0x00, 0x18, 0x50, 0xff, 0x10, 0x00, 0x00, 0x00, 0x00, 0x80, 0x01}, OpReady, 2},
+		{"previous", func(emu *Emulator) { emu.seek(2, 0) }, (*NetMD).Previous,
+			[]byte{0x00, 0x18, 0x50, 0xff, 0x10, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02}, OpReady, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			emu := NewEmulator()
+			for _, title := range []string{"A", "B", "C"} {
+				emu.AddTrack(title, EncSP, ChanStereo, 10)
+			}
+			if tt.setup != nil {
+				tt.setup(emu)
+			}
+			c := &commandTransport{Transport: emu}
+			md := NewNetMDWithTransport(c, false)
+			if err := tt.call(md); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(c.last, tt.command) {
+				t.Fatalf("sent % x, want % x", c.last, tt.command)
+			}
+			if s, err := md.RequestOperatingStatus(); err != nil || s != tt.status {
+				t.Fatalf("operating status %#x, %v, want %#x", s, err, tt.status)
+			}
+			if p, err := md.RequestPosition(); err != nil || p.Track != tt.track {
+				t.Fatalf("position %+v, %v, want track %d", p, err, tt.track)
+			}
+		})
+	}
+
+	// without a disc the deck refuses to play
+	emu := NewEmulator()
+	emu.Present = false
+	if err := NewNetMDWithTransport(emu, false).Play(); !errors.Is(err, ErrRejected) {
+		t.Fatalf("play without a disc returned %v", err)
+	}
+}
+
+func TestSeek(t *testing.T) {
+	emu := NewEmulator()
+	for _, title := range []string{"A", "B", "C"} {
+		emu.AddTrack(title, EncSP, ChanStereo, 120)
+	}
+	c := &commandTransport{Transport: emu}
+	md := NewNetMDWithTransport(c, false)
+
+	if err := md.GotoTrack(2); err != nil {
+		t.Fatal(err)
+	}
+	if want := []byte{0x00, 0x18, 0x50, 0xff, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02}; !bytes.Equal(c.last, want) {
+		t.Fatalf("goto track sent % x, want % x", c.last, want)
+	}
+	if p, err := md.RequestPosition(); err != nil || p != (Position{Track: 2}) {
+		t.Fatalf("position %+v, %v after goto track", p, err)
+	}
+
+	if err := md.GotoTime(1, 0, 1, 5, 20); err != nil {
+		t.Fatal(err)
+	}
+	if want := []byte{0x00, 0x18, 0x50, 0xff, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0x00, 0x01, 0x05, 0x20}; !bytes.Equal(c.last, want) {
+		t.Fatalf("goto time sent % x, want % x", c.last, want)
+	}
+	p, err := md.RequestPosition()
+	if err != nil || p != (Position{Track: 1, Minute: 1, Second: 5, Frame: 20}) || p.Seconds() != 65 {
+		t.Fatalf("position %+v, %v after goto time", p, err)
+	}
+
+	if err = md.GotoTrack(3); !errors.Is(err, ErrRejected) {
+		t.Fatalf("goto a missing track returned %v", err)
+	}
+	if err = md.GotoTime(0, 0, 2, 1, 0); !errors.Is(err, ErrRejected) {
+		t.Fatalf("goto past the end of the track returned %v", err)
+	}
+	c.last = nil
+	if err = md.GotoTime(0, 0, 60, 0, 0); err == nil || c.last != nil {
+		t.Fatalf("goto an invalid time returned %v after sending % x", err, c.last)
+	}
+
+	// a garbled bcd digit in the reply is an error and the next request works again
+	md = NewNetMDWithTransport(&corruptingTransport{Transport: emu, prefix: []byte{0x00, 0x18, 0x09, 0x80, 0x01, 0x04, 0x30}, offset: 39}, false)
+	if _, err = md.RequestPosition(); err == nil {
+		t.Fatal("position with a garbled reply succeeded")
+	}
+	if p, err = md.RequestPosition(); err != nil || p.Track != 1 || p.Seconds() != 65 {
+		t.Fatalf("position %+v, %v after the garbled reply", p, err)
+	}
+}
@@ -0,0 +1,256 @@
+package netmd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+type RecordOp string
+
+const (
+	OpControlOut RecordOp = "control_out"
+	OpControlIn  RecordOp = "control_in"
+	OpPoll       RecordOp = "poll"
+	OpBulkOut    RecordOp = "bulk_out"
+	OpBulkIn     RecordOp = "bulk_in"
+)
+
+// RecordEntry is a single Transport call written as one json line by the recorder
+type RecordEntry struct {
+	Time    time.Time `json:"time"`
+	Op      RecordOp  `json:"op"`
+	Request uint8     `json:"request,omitempty"`
+	Data    string    `json:"data,omitempty"` // hex encoded
+	Length  int       `json:"length"`
+	Error   string    `json:"error,omitempty"`
+}
+
+type recorder struct {
+	Transport
+	mu   sync.Mutex
+	file *os.File
+	enc  *json.Encoder
+}
+
+// StartRecording writes every command, poll result, response and bulk transfer of this NetMD to fileName, it waits
+// for a running secure session to finish
+func (md *NetMD) StartRecording(fileName string) error {
+	md.lockTransport()
+	defer md.unlockTransport()
+	if _, ok := md.transport.(*recorder); ok {
+		return errors.New("already recording")
+	}
+	file, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+	md.transport = &recorder{
+		Transport: md.transport,
+		file:      file,
+		enc:       json.NewEncoder(file),
+	}
+	return nil
+}
+
+// StopRecording closes the recording file and restores the original Transport
+func (md *NetMD) StopRecording() error {
+	md.lockTransport()
+	defer md.unlockTransport()
+	r, ok := md.transport.(*recorder)
+	if !ok {
+		return errors.New("not recording")
+	}
+	md.transport = r.Transport
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.file.Close()
+}
+
+// lockTransport makes sure no secure session or command uses the Transport while it is replaced
+func (md *NetMD) lockTransport() {
+	md.lockSession(context.Background())
+	md.lockCommand(context.Background())
+}
+
+func (md *NetMD) unlockTransport() {
+	md.unlockCommand()
+	md.unlockSession()
+}
+
+func (r *recorder) write(op RecordOp, request uint8, data []byte, n int, err error) {
+	e := RecordEntry{
+		Time:    time.Now(),
+		Op:      op,
+		Request: request,
+		Length:  n,
+	}
+	if data != nil && n > 0 && n <= len(data) {
+		e.Data = hex.EncodeToString(data[:n])
+	}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.enc.Encode(e); err != nil {
+		log.Printf("!! recording failed: %s", err)
+	}
+}
+
+func (r *recorder) ControlOut(request uint8, data []byte) (int, error) {
+	n, err := r.Transport.ControlOut(request, data)
+	r.write(OpControlOut, request, data, n, err)
+	return n, err
+}
+
+func (r *recorder) ControlIn(request uint8, data []byte) (int, error) {
+	n, err := r.Transport.ControlIn(request, data)
+	r.write(OpControlIn, request, data, n, err)
+	return n, err
+}
+
+func (r *recorder) Poll(data []byte) (int, error) {
+	n, err := r.Transport.Poll(data)
+	r.write(OpPoll, 0x01, data, n, err)
+	return n, err
+}
+
+func (r *recorder) BulkOut(data []byte) (int, error) {
+	n, err := r.Transport.BulkOut(data)
+	r.write(OpBulkOut, 0, data, n, err)
+	return n, err
+}
+
+func (r *recorder) BulkIn(data []byte) (int, error) {
+	n, err := r.Transport.BulkIn(data)
+	r.write(OpBulkIn, 0, data, n, err)
+	return n, err
+}
+
+// Replay is a Transport that serves the responses of a recording made with StartRecording back in order
+type Replay struct {
+	Debug   bool
+	entries []RecordEntry
+	pos     int
+	mu      sync.Mutex
+}
+
+// NewReplay reads the recording in fileName
+func NewReplay(fileName string) (*Replay, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return NewReplayFromReader(file)
+}
+
+// NewReplayFromReader reads a recording from r
+func NewReplayFromReader(r io.Reader) (*Replay, error) {
+	rp := &Replay{}
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for s.Scan() {
+		if len(bytes.TrimSpace(s.Bytes())) == 0 {
+			continue
+		}
+		var e RecordEntry
+		if err := json.Unmarshal(s.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("replay: entry %d: %w", len(rp.entries), err)
+		}
+		rp.entries = append(rp.entries, e)
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return rp, nil
+}
+
+// Remaining returns the number of recorded entries not yet replayed
+func (rp *Replay) Remaining() int {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+	return len(rp.entries) - rp.pos
+}
+
+// next returns the next recorded entry, it must match the op requested by the library
+func (rp *Replay) next(op RecordOp, request uint8) (*RecordEntry, error) {
+	if rp.pos >= len(rp.entries) {
+		return nil, fmt.Errorf("replay: no more recorded entries, expected %s", op)
+	}
+	e := &rp.entries[rp.pos]
+	if e.Op != op || e.Request != request {
+		return nil, fmt.Errorf("replay: entry %d is %s (%#x) but %s (%#x) was requested", rp.pos, e.Op, e.Request, op, request)
+	}
+	rp.pos++
+	return e, nil
+}
+
+func (rp *Replay) result(e *RecordEntry) (int, error) {
+	if e.Error != "" {
+		return e.Length, errors.New(e.Error)
+	}
+	return e.Length, nil
+}
+
+func (rp *Replay) out(op RecordOp, request uint8, data []byte) (int, error) {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+	e, err := rp.next(op, request)
+	if err != nil {
+		return 0, err
+	}
+	if rp.Debug && e.Data != "" && e.Data != hex.EncodeToString(data) {
+		log.Printf("replay: entry %d data differs from recording\n   recorded: %s\n   sent:     % x", rp.pos-1, e.Data, data)
+	}
+	return rp.result(e)
+}
+
+func (rp *Replay) in(op RecordOp, request uint8, data []byte) (int, error) {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+	e, err := rp.next(op, request)
+	if err != nil {
+		return 0, err
+	}
+	d, err := hex.DecodeString(e.Data)
+	if err != nil {
+		return 0, fmt.Errorf("replay: entry %d: %w", rp.pos-1, err)
+	}
+	copy(data, d)
+	return rp.result(e)
+}
+
+func (rp *Replay) ControlOut(request uint8, data []byte) (int, error) {
+	return rp.out(OpControlOut, request, data)
+}
+
+func (rp *Replay) ControlIn(request uint8, data []byte) (int, error) {
+	return rp.in(OpControlIn, request, data)
+}
+
+func (rp *Replay) Poll(data []byte) (int, error) {
+	return rp.in(OpPoll, 0x01, data)
+}
+
+func (rp *Replay) BulkOut(data []byte) (int, error) {
+	return rp.out(OpBulkOut, 0, data)
+}
+
+func (rp *Replay) BulkIn(data []byte) (int, error) {
+	return rp.in(OpBulkIn, 0, data)
+}
+
+func (rp *Replay) Close() error {
+	return nil
+}
@@ -0,0 +1,67 @@
+package netmd
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRecordReplay(t *testing.T) {
+	session := func(t *testing.T, md *NetMD) *Disc {
+		t.Helper()
+		sendTestTrack(t, md, "Recorded", 2, 1)
+		if err := md.SetTrackTitle(0, "Renamed", false); err != nil {
+			t.Fatal(err)
+		}
+		d, err := md.ReadDisc()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+
+	fileName := filepath.Join(t.TempDir(), "session.jsonl")
+	emu := NewEmulator()
+	md := NewNetMDWithTransport(emu, false)
+	if err := md.StartRecording(fileName); err != nil {
+		t.Fatal(err)
+	}
+	if err := md.StartRecording(fileName); err == nil {
+		t.Fatal("recording twice succeeded")
+	}
+	recorded := session(t, md)
+	if err := md.StopRecording(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := md.transport.(*Emulator); !ok {
+		t.Fatalf("transport after StopRecording is %T", md.transport)
+	}
+
+	rp, err := NewReplay(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rp.Remaining() == 0 {
+		t.Fatal("nothing was recorded")
+	}
+	replayed := session(t, NewNetMDWithTransport(rp, false))
+	if !reflect.DeepEqual(recorded.Tracks, replayed.Tracks) || recorded.Capacity != replayed.Capacity {
+		t.Fatalf("replayed disc %+v, recorded %+v", replayed, recorded)
+	}
+	if rp.Remaining() != 0 {
+		t.Fatalf("%d entries were not replayed", rp.Remaining())
+	}
+
+	// a replay that runs out of entries or is asked something else fails instead of making up responses
+	if _, err = NewNetMDWithTransport(rp, false).RequestTrackCount(); err == nil || !strings.Contains(err.Error(), "replay") {
+		t.Fatalf("request after the end of the replay returned %v", err)
+	}
+	rp, err = NewReplay(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = rp.BulkOut([]byte{0x00}); err == nil {
+		t.Fatal("bulk out replayed in place of the first poll")
+	}
+}
@@ -1,67 +1,277 @@
 package netmd
 
 import (
-	"errors"
+	"context"
+	"fmt"
 	"log"
+	"time"
 )
 
 type TransferType string
 
+type TransferStage string
+
 type Transfer struct {
 	Type        TransferType
+	Stage       TransferStage
+	Index       int // position of the Track in the slice given to SendTracks
 	Track       int
 	Transferred int
 	Error       error
 }
 
+// SendError is the error of a Send that failed or was cancelled, Stage is the last stage it reached
+type SendError struct {
+	Stage TransferStage
+	Err   error
+}
+
+func (e *SendError) Error() string {
+	return fmt.Sprintf("send failed during %s: %s", e.Stage, e.Err)
+}
+
+func (e *SendError) Unwrap() error {
+	return e.Err
+}
+
 const (
-	TtSetup TransferType = "setup"
-	TtSend  TransferType = "send"
-	TtPoll  TransferType = "poll"
-	TtTrack TransferType = "track"
+	TtSetup   TransferType = "setup"
+	TtSend    TransferType = "send"
+	TtPoll    TransferType = "poll"
+	TtTrack   TransferType = "track"
+	TtDone    TransferType = "done"
+	TtReceive TransferType = "receive"
+
+	StageSetup    TransferStage = "setup"    // acquiring the device
+	StageSession  TransferStage = "session"  // secure session entered and keys exchanged
+	StageTransfer TransferStage = "transfer" // writing (or reading) the packets on the bulk endpoint
+	StageFinish   TransferStage = "finish"   // waiting for the device to finish the data write
+	StageTitle    TransferStage = "title"    // track created, writing the title and toc
+	StageCommit   TransferStage = "commit"   // title and toc are written and the track waits to be committed
+	StageDone     TransferStage = "done"
 )
 
+// SendResult is returned by SendTrack
+type SendResult struct {
+	Track        int           // track number of the committed track starting from 0
+	Stage        TransferStage // last stage reached, StageDone on success
+	TotalBytes   int           // bytes the track takes on the wire
+	Transferred  int           // bytes written to the bulk endpoint
+	Started      time.Time
+	Elapsed      time.Duration // time of the whole send
+	TransferTime time.Duration // time spent writing packets to the bulk endpoint
+}
+
 // Send will transmit the Track data encrypted (concurrent) to the NetMD
-// the Transfer channel will receive different TransferType's so the process can be followed closely from a different process
+// the Transfer channel will receive different TransferType's so the process can be followed closely from a different process,
+// c must be read until it is closed, use SendContext to stop waiting for a reader that went away
 func (md *NetMD) Send(trk *Track, c chan Transfer) {
+	md.SendContext(context.Background(), trk, c)
+}
+
+// SendContext is Send with a ctx to cancel the call or set a deadline, when ctx is done the bulk writes are stopped
+// and the secure session is torn down so the device stays usable, the last Transfer will hold a SendError. Transfers that
+// can not be delivered before ctx is done are dropped, so the goroutine never outlives ctx when c is not read anymore
+func (md *NetMD) SendContext(ctx context.Context, trk *Track, c chan Transfer) {
 	if c == nil {
 		return
 	}
 	defer close(c)
 
+	deliver := func(t Transfer) {
+		select {
+		case c <- t:
+		case <-ctx.Done():
+		}
+	}
+
+	res, err := md.SendTrackContext(ctx, trk, deliver)
+
+	// after a cancel the result is only delivered when c is still read
+	if err != nil {
+		if ctx.Err() != nil {
+			select {
+			case c <- Transfer{Stage: res.Stage, Track: res.Track, Error: err}:
+			default:
+			}
+			return
+		}
+		deliver(Transfer{
+			Stage: res.Stage,
+			Track: res.Track,
+			Error: err,
+		})
+		return
+	}
+
+	deliver(Transfer{
+		Type:        TtDone,
+		Stage:       StageDone,
+		Track:       res.Track,
+		Transferred: res.Transferred,
+	})
+}
+
+// SendTrack will transmit the Track data encrypted to the NetMD and blocks until it is committed,
+// the optional progress func is called with the same Transfer's Send puts on its channel
+func (md *NetMD) SendTrack(trk *Track, progress func(Transfer)) (*SendResult, error) {
+	return md.SendTrackContext(context.Background(), trk, progress)
+}
+
+// SendTrackContext is SendTrack with a ctx to cancel the call or set a deadline, when ctx is done the bulk writes are stopped
+// and the secure session is torn down so the device stays usable
+func (md *NetMD) SendTrackContext(ctx context.Context, trk *Track, progress func(Transfer)) (*SendResult, error) {
+	res, err := md.SendTracksContext(ctx, []*Track{trk}, progress)
+	return res[0], err
+}
+
+// SendTracks will transmit and title all tracks in one secure session and commits them at the end,
+// it stops at the first failing track and returns a SendResult for every track that was started
+func (md *NetMD) SendTracks(trks []*Track, progress func(Transfer)) ([]*SendResult, error) {
+	return md.SendTracksContext(context.Background(), trks, progress)
+}
+
+// SendTracksContext is SendTracks with a ctx to cancel the call or set a deadline
+func (md *NetMD) SendTracksContext(ctx context.Context, trks []*Track, progress func(Transfer)) ([]*SendResult, error) {
+	results := make([]*SendResult, 0, len(trks))
+	if len(trks) == 0 {
+		return results, nil
+	}
+	results = append(results, newSendResult(trks[0]))
+	notify := func(t Transfer) {
+		if progress != nil {
+			res := results[len(results)-1]
+			if t.Stage == "" {
+				t.Stage = res.Stage
+			}
+			t.Index = len(results) - 1
+			progress(t)
+		}
+	}
+
+	if err := md.lockSession(ctx); err != nil {
+		return results, &SendError{Stage: StageSetup, Err: err}
+	}
+	defer md.unlockSession()
+
+	// a streamed track can only be sent once, refuse the batch before the device is touched
+	for i, trk := range trks {
+		if err := trk.rewind(); err != nil {
+			return results, &SendError{Stage: StageSetup, Err: fmt.Errorf("track %d: %w", i, err)}
+		}
+	}
+
 	// housekeeping
-	md.leaveSecureSession()
-	md.acquire()
-	md.trackProtection(0x01) // not implemented in sharp
+	md.leaveSecureSession(ctx)
+	if err := md.acquire(ctx); err != nil {
+		return results, &SendError{Stage: StageSetup, Err: fmt.Errorf("acquiring the device failed: %w", err)}
+	}
+	md.trackProtection(ctx, 0x01) // not implemented in sharp
 
-	c <- Transfer{
+	notify(Transfer{
 		Type: TtSetup,
+	})
+
+	defer md.teardown()
+	sessionKey, err := md.openSecureSession(ctx)
+	if err != nil {
+		results[0].Stage = StageSession
+		results[0].Elapsed = time.Since(results[0].Started)
+		return results, &SendError{Stage: StageSession, Err: err}
+	}
+
+	for i, trk := range trks {
+		if i > 0 {
+			results = append(results, newSendResult(trk))
+		}
+		res := results[i]
+		res.Stage = StageSession
+		if err = md.sendTrack(ctx, trk, res, notify); err != nil {
+			res.Elapsed = time.Since(res.Started)
+			err = &SendError{Stage: res.Stage, Err: err}
+			break
+		}
 	}
 
-	md.enterSecureSession()
+	// commit every track that was titled, also when a later track failed or ctx was cancelled
+	cctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+	for _, res := range results {
+		if res.Stage != StageCommit {
+			continue
+		}
+		cerr := md.commitTrack(cctx, res.Track, sessionKey) // not implemented in sharp
+		res.Elapsed = time.Since(res.Started)
+		if cerr != nil {
+			if err == nil {
+				err = &SendError{Stage: res.Stage, Err: fmt.Errorf("committing track failed: %w", cerr)}
+			}
+			continue
+		}
+		res.Stage = StageDone
+	}
 
-	md.sendKeyData()
-	md.sessionKeyExchange()
-	sessionKey, _ := md.ekb.RetailMAC() // build the local sessionKey
-	md.kekExchange(sessionKey)          // (data) key encryption key
+	return results, err
+}
 
-	err := md.startSecureSend(trk.Format, trk.DiscFormat, trk.Frames, trk.TotalBytes())
+// openSecureSession enters the secure session and exchanges the keys, it returns the session key
+func (md *NetMD) openSecureSession(ctx context.Context) ([]byte, error) {
+	if err := md.enterSecureSession(ctx); err != nil {
+		return nil, fmt.Errorf("entering the secure session failed: %w", err)
+	}
+	if err := md.sendKeyData(ctx); err != nil {
+		return nil, fmt.Errorf("sending the key data failed: %w", err)
+	}
+	if err := md.sessionKeyExchange(ctx); err != nil {
+		return nil, fmt.Errorf("session key exchange failed: %w", err)
+	}
+	sessionKey, err := md.ekb.RetailMAC() // build the local sessionKey
 	if err != nil {
-		c <- Transfer{
-			Error: err,
-		}
-		return
+		return nil, err
 	}
+	if err = md.kekExchange(ctx, sessionKey); err != nil { // (data) key encryption key
+		return nil, fmt.Errorf("key encryption key exchange failed: %w", err)
+	}
+	return sessionKey, nil
+}
+
+func newSendResult(trk *Track) *SendResult {
+	return &SendResult{
+		Stage:      StageSetup,
+		TotalBytes: trk.TotalBytes(),
+		Started:    time.Now(),
+	}
+}
+
+// sendTrack writes a single track inside an opened secure session and sets its title, res is updated along the way
+func (md *NetMD) sendTrack(ctx context.Context, trk *Track, res *SendResult, notify func(Transfer)) error {
+	if err := trk.rewind(); err != nil {
+		return err // the same streamed track twice in one batch
+	}
+	if err := md.startSecureSend(ctx, trk.Format, trk.DiscFormat, trk.Frames, trk.TotalBytes()); err != nil {
+		return err
+	}
+	res.Stage = StageTransfer
 
 	key, _ := DESDecrypt(trk.key, md.ekb.kek)
-	dataCounter := 0
 
-	c <- Transfer{
+	notify(Transfer{
 		Type:        TtSend,
-		Transferred: dataCounter,
-	}
+		Transferred: res.Transferred,
+	})
 
-	for i, p := range trk.Packets {
+	start := time.Now()
+	for i := 0; ; i++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		p, err := trk.nextPacket()
+		if err != nil {
+			return err
+		}
+		if p == nil {
+			break
+		}
 		s := make([]byte, 0)
 		if p.first {
 			s = append(s, intToHex64(int64(trk.Frames*FrameSize[trk.Format]))...)
@@ -69,82 +279,65 @@ func (md *NetMD) Send(trk *Track, c chan Transfer) {
 			s = append(s, md.ekb.iv...)
 		}
 		s = append(s, p.data...)
-		t, err := md.out.Write(s)
+		t, err := md.transport.BulkOut(s)
+		res.Transferred += t
+		res.TransferTime = time.Since(start)
 		if err != nil {
-			c <- Transfer{
-				Error: err,
-			}
-			close(c)
-			return
+			return err
 		}
-		dataCounter += t
-		c <- Transfer{
+		notify(Transfer{
 			Type:        TtSend,
-			Transferred: dataCounter,
-		}
+			Transferred: res.Transferred,
+		})
 		if md.debug {
-			log.Printf("Packet %d / %d Transmitted: %d bytes", i, len(trk.Packets), dataCounter)
+			log.Printf("Packet %d Transmitted: %d / %d bytes", i, res.Transferred, res.TotalBytes)
 		}
 	}
 
 	if md.debug {
 		log.Println("Going to wait for MD to finish data write...")
 	}
+	res.Stage = StageFinish
 
-	r, err := md.finishSecureSend(c)
+	r, err := md.finishSecureSend(ctx, notify)
 	if err != nil {
-		c <- Transfer{
-			Error: errors.New("data write never finished"),
-		}
-		return
+		return fmt.Errorf("data write never finished: %w", err)
+	}
+	if err = expect(r, 19); err != nil {
+		return err
 	}
 
-	j := hexToInt16(r[17:19])
-	trackNr := int(j)
+	res.Track = int(hexToInt16(r[17:19]))
 	if md.debug {
-		log.Printf("track %d committed", trackNr)
+		log.Printf("track %d committed", res.Track)
 	}
+	res.Stage = StageTitle
 
-	c <- Transfer{
+	notify(Transfer{
 		Type:  TtTrack,
-		Track: trackNr,
-	}
-
-	err = md.cacheTOC()
-	if err != nil {
-		c <- Transfer{
-			Error: errors.New("toc cache failed"),
-		}
-		return
-	}
+		Track: res.Track,
+	})
 
-	err = md.SetTrackTitle(trackNr, trk.Title, true)
-	if err != nil {
-		c <- Transfer{
-			Error: errors.New("setting track title failed"),
-		}
-		return
+	if err = md.cacheTOC(ctx); err != nil {
+		return fmt.Errorf("toc cache failed: %w", err)
 	}
 
-	err = md.syncTOC()
-	if err != nil {
-		c <- Transfer{
-			Error: errors.New("toc sync failed"),
-		}
-		return
+	if err = md.SetTrackTitleContext(ctx, res.Track, trk.Title, true); err != nil {
+		return fmt.Errorf("setting track title failed: %w", err)
 	}
 
-	err = md.commitTrack(trackNr, sessionKey) // not implemented in sharp
-	if err != nil {
-		c <- Transfer{
-			Error: errors.New("committing track failed"),
-		}
-		return
+	if err = md.syncTOC(ctx); err != nil {
+		return fmt.Errorf("toc sync failed: %w", err)
 	}
+	res.Stage = StageCommit
+	return nil
+}
 
-	md.forgetSecureKey()
-	md.leaveSecureSession()
-	md.release()
-
-	return
+// teardown leaves the secure session and releases the device, it does not use the ctx of the send so it also runs when that was cancelled
+func (md *NetMD) teardown() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+	md.forgetSecureKey(ctx)
+	md.leaveSecureSession(ctx)
+	md.release(ctx)
 }
@@ -0,0 +1,196 @@
+package netmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+var securePrefix = []byte{0x00, 0x18, 0x00, 0x08, 0x00, 0x46, 0xf0, 0x03, 0x01, 0x03}
+
+// loggingTransport keeps the secure session commands sent to the device, eg. 0x28 to start a send or 0x48 to commit
+type loggingTransport struct {
+	Transport
+	secure []byte
+}
+
+func (l *loggingTransport) ControlOut(request uint8, data []byte) (int, error) {
+	if bytes.HasPrefix(data, securePrefix) && len(data) > len(securePrefix) {
+		l.secure = append(l.secure, data[len(securePrefix)])
+	}
+	return l.Transport.ControlOut(request, data)
+}
+
+func testTracks(t *testing.T, md *NetMD, titles ...string) []*Track {
+	t.Helper()
+	var trks []*Track
+	for _, title := range titles {
+		w := testWav(2, 1)
+		trk, err := md.NewTrackFromReader(title, bytes.NewReader(w), int64(len(w)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		trks = append(trks, trk)
+	}
+	return trks
+}
+
+func TestSendTracks(t *testing.T) {
+	emu := NewEmulator()
+	log := &loggingTransport{Transport: emu}
+	md := NewNetMDWithTransport(log, false)
+
+	var index []int
+	results, err := md.SendTracks(testTracks(t, md, "One", "Two", "Three"), func(tr Transfer) {
+		if len(index) == 0 || index[len(index)-1] != tr.Index {
+			index = append(index, tr.Index)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 3 || len(emu.Tracks) != 3 {
+		t.Fatalf("%d results and %d tracks on the disc", len(results), len(emu.Tracks))
+	}
+	for i, res := range results {
+		if res.Stage != StageDone || res.Track != i || res.Transferred != res.TotalBytes {
+			t.Fatalf("result %d %+v", i, res)
+		}
+		if want := []string{"One", "Two", "Three"}[i]; emu.Tracks[i].Title != want {
+			t.Fatalf("track %d is titled %q, want %q", i, emu.Tracks[i].Title, want)
+		}
+	}
+	if !equalInts(index, []int{0, 1, 2}) {
+		t.Fatalf("progress of the tracks came in the order %v", index)
+	}
+
+	// one session for the batch and the tracks are only committed after the last one was sent
+	if c := bytes.Count(log.secure, []byte{0x80}); c != 1 {
+		t.Fatalf("entered the secure session %d times", c)
+	}
+	last := bytes.LastIndexByte(log.secure, 0x28)
+	if first := bytes.IndexByte(log.secure, 0x48); first < last || bytes.Count(log.secure, []byte{0x48}) != 3 {
+		t.Fatalf("secure commands % x do not commit the 3 tracks at the end", log.secure)
+	}
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestSendTracksFailure(t *testing.T) {
+	emu := NewEmulator()
+	md := NewNetMDWithTransport(emu, false)
+	trks := testTracks(t, md, "One")
+
+	// the second track breaks off halfway through its audio, the third is never started
+	errRead := errors.New("read failed")
+	w := testWav(2, 1)
+	broken, err := md.NewTrackFromReader("Two", io.MultiReader(bytes.NewReader(w[:len(w)/2]), iotest.ErrReader(errRead)), int64(len(w)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	trks = append(trks, broken)
+	trks = append(trks, testTracks(t, md, "Three")...)
+
+	results, err := md.SendTracks(trks, nil)
+	var serr *SendError
+	if !errors.As(err, &serr) || serr.Stage != StageTransfer || !errors.Is(err, errRead) {
+		t.Fatalf("send returned %v", err)
+	}
+	if len(results) != 2 || results[0].Stage != StageDone || results[1].Stage != StageTransfer {
+		t.Fatalf("results %+v %+v", results[0], results[1:])
+	}
+	// the first track was committed anyway and the device is usable again
+	if c, err := md.RequestTrackCount(); err != nil || c != 1 || emu.Tracks[0].Title != "One" {
+		t.Fatalf("track count %d, %v after the failed batch", c, err)
+	}
+	if res := sendTestTrack(t, md, "Again", 2, 1); res.Stage != StageDone || res.Track != 1 {
+		t.Fatalf("send after the failed batch %+v", res)
+	}
+}
+
+func TestSendTracksCommitFailure(t *testing.T) {
+	emu := NewEmulator()
+	md := NewNetMDWithTransport(&failingTransport{Transport: emu, prefix: append(securePrefix, 0x48)}, false)
+	results, err := md.SendTracks(testTracks(t, md, "One", "Two"), nil)
+	var serr *SendError
+	if !errors.As(err, &serr) || serr.Stage != StageCommit || !errors.Is(err, errTransport) {
+		t.Fatalf("send returned %v", err)
+	}
+	for i, res := range results {
+		if res.Stage != StageCommit || res.Track != i {
+			t.Fatalf("result %d %+v", i, res)
+		}
+	}
+}
+
+func TestSendStreamedTrackTwice(t *testing.T) {
+	log := &loggingTransport{Transport: NewEmulator()}
+	md := NewNetMDWithTransport(log, false)
+	trks := testTracks(t, md, "Once", "New")
+	if _, err := md.SendTrack(trks[0], nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// the batch is refused before the secure session is entered
+	log.secure = nil
+	results, err := md.SendTracks([]*Track{trks[1], trks[0]}, nil)
+	var serr *SendError
+	if !errors.As(err, &serr) || serr.Stage != StageSetup || !strings.Contains(err.Error(), "track 1") {
+		t.Fatalf("send returned %v", err)
+	}
+	if len(results) != 1 || results[0].Stage != StageSetup || len(log.secure) != 0 {
+		t.Fatalf("results %+v after the secure commands % x", results[0], log.secure)
+	}
+}
+
+func TestSendCancel(t *testing.T) {
+	emu := NewEmulator()
+	log := &loggingTransport{Transport: emu}
+	md := NewNetMDWithTransport(log, false)
+	w := testWav(2, 4) // more than one packet
+	trk, err := md.NewTrackFromReader("Cancelled", bytes.NewReader(w), int64(len(w)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// cancel as soon as the first packet was written
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	res, err := md.SendTrackContext(ctx, trk, func(tr Transfer) {
+		if tr.Type == TtSend && tr.Transferred > 0 {
+			cancel()
+		}
+	})
+	var serr *SendError
+	if !errors.Is(err, ctx.Err()) || !errors.As(err, &serr) || serr.Stage != StageTransfer {
+		t.Fatalf("cancelled send returned %v", err)
+	}
+	if res.Stage != StageTransfer || res.Transferred == 0 || res.Transferred >= res.TotalBytes {
+		t.Fatalf("cancelled send result %+v", res)
+	}
+
+	// the session was torn down and the device still answers
+	if l := len(log.secure); l < 3 || !bytes.Equal(log.secure[l-2:], []byte{0x21, 0x81}) {
+		t.Fatalf("secure commands % x do not end with forgetting the key and leaving the session", log.secure)
+	}
+	if c, err := md.RequestTrackCount(); err != nil || c != 0 {
+		t.Fatalf("track count %d, %v after the cancelled send", c, err)
+	}
+	if res := sendTestTrack(t, md, "After", 2, 1); res.Stage != StageDone || res.Track != 0 {
+		t.Fatalf("send after the cancelled send %+v", res)
+	}
+}
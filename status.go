@@ -0,0 +1,75 @@
+package netmd
+
+import "context"
+
+const discFlagWriteProtected = 0x40
+
+// DeviceStatus is the decoded status and operating status of the device, there is no flag for a dirty TOC
+// (changes not yet written to the disc) because the byte holding it is not known
+type DeviceStatus struct {
+	DiscPresent    bool
+	WriteProtected bool // the write protect tab of the disc is set, titles and tracks can not be edited
+	Operating      OperatingStatus
+	Playing        bool // playing, fast forwarding or rewinding
+	Paused         bool // playback is paused, Playing is false then
+	Busy           bool // the device is reading the TOC and does not accept commands
+}
+
+// RequestDeviceStatus returns the decoded DeviceStatus
+func (md *NetMD) RequestDeviceStatus() (DeviceStatus, error) {
+	return md.RequestDeviceStatusContext(context.Background())
+}
+
+// RequestDeviceStatusContext is RequestDeviceStatus with a ctx to cancel the call or set a deadline
+func (md *NetMD) RequestDeviceStatusContext(ctx context.Context) (s DeviceStatus, err error) {
+	r, err := md.requestStatus(ctx)
+	if err != nil {
+		return
+	}
+	s.DiscPresent = r[26] == 0x40
+
+	if s.Operating, err = md.RequestOperatingStatusContext(ctx); err != nil {
+		return
+	}
+	switch s.Operating {
+	case OpPlaying, OpFastForward, OpRewind:
+		s.Playing = true
+	case OpPaused:
+		s.Paused = true
+	case OpReadingTOC:
+		s.Busy = true
+	}
+
+	if s.DiscPresent && !s.Busy {
+		flags, err := md.requestDiscFlags(ctx)
+		if err != nil {
+			return s, err
+		}
+		s.WriteProtected = flags&discFlagWriteProtected != 0
+	}
+	return
+}
+
+// requestStatus returns the raw response of the status query, the disc state is at 26
+func (md *NetMD) requestStatus(ctx context.Context) ([]byte, error) {
+	r, err := md.submit(ctx, ControlAccepted, []byte{0x18, 0x09, 0x80, 0x01, 0x02, 0x30}, []byte{0x88, 0x00, 0x00, 0x30, 0x88, 0x04, 0x00, 0xff, 0x00, 0x00, 0x00, 0x00, 0x00})
+	if err != nil {
+		return nil, err
+	}
+	if err = expect(r, 27); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// requestDiscFlags returns the flags of the inserted disc
+func (md *NetMD) requestDiscFlags(ctx context.Context) (byte, error) {
+	r, err := md.submit(ctx, ControlAccepted, []byte{0x18, 0x06, 0x01, 0x10, 0x10, 0x00}, []byte{0xff, 0x00, 0x00, 0x01, 0x00, 0x0b})
+	if err != nil {
+		return 0, err
+	}
+	if err = expect(r, 14); err != nil {
+		return 0, err
+	}
+	return r[13], nil
+}
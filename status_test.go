@@ -0,0 +1,29 @@
+package netmd
+
+import "testing"
+
+func TestDeviceStatus(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(emu *Emulator)
+		want  DeviceStatus
+	}{
+		{"stopped", func(emu *Emulator) {}, DeviceStatus{DiscPresent: true, Operating: OpReady}},
+		{"playing", func(emu *Emulator) { emu.action = actionPlay }, DeviceStatus{DiscPresent: true, Operating: OpPlaying, Playing: true}},
+		{"paused", func(emu *Emulator) { emu.action = actionPause }, DeviceStatus{DiscPresent: true, Operating: OpPaused, Paused: true}},
+		{"rewinding", func(emu *Emulator) { emu.action = actionRewind }, DeviceStatus{DiscPresent: true, Operating: OpRewind, Playing: true}},
+		{"busy", func(emu *Emulator) { emu.Busy = true }, DeviceStatus{DiscPresent: true, Operating: OpReadingTOC, Busy: true}},
+		{"write protected", func(emu *Emulator) { emu.WriteProtected = true }, DeviceStatus{DiscPresent: true, WriteProtected: true, Operating: OpReady}},
+		{"no disc", func(emu *Emulator) { emu.Present = false }, DeviceStatus{Operating: OpNoDisc}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			emu := NewEmulator()
+			emu.AddTrack("A", EncSP, ChanStereo, 10)
+			tt.setup(emu)
+			if s, err := NewNetMDWithTransport(emu, false).RequestDeviceStatus(); err != nil || s != tt.want {
+				t.Fatalf("device status %+v, %v, want %+v", s, err, tt.want)
+			}
+		})
+	}
+}
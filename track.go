@@ -5,7 +5,8 @@ import (
 	"crypto/cipher"
 	"crypto/des"
 	"errors"
-	"log"
+	"fmt"
+	"io"
 	"os"
 )
 
@@ -15,9 +16,14 @@ type Track struct {
 	DiscFormat DiscFormat
 	Frames     int
 	Padding    int
+	Metadata   *Metadata // tags found in the file
 	Packets    []*Packet
 	position   int
 	key        []byte
+	source     io.Reader // audio data of a streamed track, nil when the Packets are prepared in memory
+	size       int       // length of the audio data in source without the padding
+	block      cipher.Block
+	iv         []byte
 }
 
 type Packet struct {
@@ -47,154 +53,268 @@ var (
 	}
 )
 
+// DiscFormat returns the DiscFormat of a track with Encoding e and Channels c
+func (e Encoding) DiscFormat(c Channels) DiscFormat {
+	switch e {
+	case EncLP2:
+		return DfLP2
+	case EncLP4:
+		return DfLP4
+	}
+	if c == ChanMono {
+		return DfMonoSP
+	}
+	return DfStereoSP
+}
+
 func (trk *Track) TotalBytes() int {
 	return (trk.Frames * FrameSize[trk.Format]) + 24
 }
 
-func (md *NetMD) NewTrack(title string, fileName string) (trk *Track, err error) {
-	trk = &Track{
-		Format:     WfPCM,
-		DiscFormat: DfStereoSP,
-		Title:      title,
-		key:        md.ekb.CreateKey(),
-	}
+// NewTrack reads the wav, oma/omg or aea file in fileName and prepares all encrypted Packets in memory so the Track can be sent more than once,
+// aea files are decoded with the registered Codec
+func (md *NetMD) NewTrack(title string, fileName string) (*Track, error) {
+	return md.newTrackFromFile(fileName, func(r io.Reader, size int64) (*Track, error) {
+		return md.NewTrackFromReader(title, r, size)
+	})
+}
+
+// NewTrackWithFormat is NewTrack that encodes pcm audio to ATRAC3 when df is DfLP2 or DfLP4 so the track takes two
+// or four times less space on the disc, files that already hold audio of df are used as is. Encoding needs the
+// registered Codec
+func (md *NetMD) NewTrackWithFormat(title string, fileName string, df DiscFormat) (*Track, error) {
+	return md.newTrackFromFile(fileName, func(r io.Reader, size int64) (*Track, error) {
+		return md.NewTrackFromReaderWithFormat(title, r, size, df)
+	})
+}
 
+func (md *NetMD) newTrackFromFile(fileName string, read func(r io.Reader, size int64) (*Track, error)) (trk *Track, err error) {
 	file, err := os.Open(fileName)
-	defer file.Close()
 	if err != nil {
 		return
 	}
+	defer file.Close()
 	stat, err := file.Stat()
 	if err != nil {
 		return
 	}
-	audioData := make([]byte, stat.Size())
-	_, err = file.Read(audioData)
+	trk, err = read(file, stat.Size())
 	if err != nil {
-		return
+		return nil, err
 	}
 
-	if !bytes.Equal(audioData[0:4], []byte("RIFF")) {
-		return nil, errors.New("wav: riff header not found")
+	for {
+		p, err := trk.nextPacket()
+		if err != nil {
+			return nil, err
+		}
+		if p == nil {
+			break
+		}
+		trk.Packets = append(trk.Packets, p)
 	}
-	size := int64(audioData[4]) | int64(audioData[5])<<8 | int64(audioData[6])<<16 | int64(audioData[7])<<24
-	if size < 16 {
-		return nil, errors.New("wav: header size too small < 16")
+	trk.source = nil
+	trk.position = 0
+	return
+}
+
+// NewTrackFromReader reads a wav, oma/omg or aea file from r (of size bytes or -1 if unknown), the audio data is byte-swapped,
+// padded and encrypted chunk by chunk while it is sent so memory use stays bounded, a Track made this way can only be sent once.
+// When title is empty it is built from the Metadata with the title template, tags after the audio data are only read when r is an io.Seeker
+func (md *NetMD) NewTrackFromReader(title string, r io.Reader, size int64) (*Track, error) {
+	trk, err := readTrack(title, r, size)
+	if err != nil {
+		return nil, err
+	}
+	if err = md.prepareTrack(trk); err != nil {
+		return nil, err
 	}
+	return trk, nil
+}
 
-	format := int(audioData[20]) | int(audioData[21])<<8 // 1 = linear PCM
-	sampleRate := int64(audioData[24]) | int64(audioData[25])<<8 | int64(audioData[26])<<16 | int64(audioData[27])<<24
-	bitsPerSample := int(audioData[34]) | int(audioData[35])<<8
-	channelNum := int(audioData[22]) | int(audioData[23])<<8
+// NewTrackFromReaderWithFormat is NewTrackFromReader that encodes pcm audio like NewTrackWithFormat while it is sent
+func (md *NetMD) NewTrackFromReaderWithFormat(title string, r io.Reader, size int64, df DiscFormat) (*Track, error) {
+	trk, err := readTrack(title, r, size)
+	if err != nil {
+		return nil, err
+	}
+	if err = trk.encode(df); err != nil {
+		return nil, err
+	}
+	if err = md.prepareTrack(trk); err != nil {
+		return nil, err
+	}
+	return trk, nil
+}
 
-	switch format {
-	case 624:
-		bitsPerSample = int(hexToInt16LE(audioData[32:34]))
-		if bitsPerSample == 384 {
-			trk.Format = WfLP2
-			trk.DiscFormat = DfLP2
-		} else {
-			return nil, errors.New("atrac3: block size not supported")
-		}
-	case 1:
-		if sampleRate != 44100 || bitsPerSample != 16 {
-			return nil, errors.New("pcm: sample rate must be 44100 @ 16 bits")
-		}
-		if channelNum != 1 {
-			trk.DiscFormat = DfMonoSP
-		}
+// readTrack detects the container in r and sets the format and audio source of a new Track
+func readTrack(title string, r io.Reader, size int64) (trk *Track, err error) {
+	trk = newTrack(title)
+
+	// the container is detected by the first bytes, the header readers get them back through hr
+	magic := make([]byte, 4)
+	if _, err = io.ReadFull(r, magic); err != nil {
+		return nil, errors.New("track: file too short")
+	}
+	hr := io.MultiReader(bytes.NewReader(magic), r)
+
+	switch {
+	case string(magic) == "RIFF":
+		err = trk.readWav(hr, r, size)
+	case string(magic[:3]) == "ea3" || string(magic[:3]) == "EA3":
+		err = trk.readOMA(hr, size)
+	case bytes.Equal(magic, aeaMagic):
+		err = trk.readAEA(hr, size)
 	default:
-		return nil, errors.New("wav: must be linear pcm (1) or atrac3 (624)")
+		err = errors.New("track: unknown file format, must be wav, oma/omg or aea")
+	}
+	if err != nil {
+		return nil, err
 	}
+	return
+}
 
-	// search for wav 'data' header
-	max := len(audioData) - 4
-	c := 0
-	s := audioData[c : c+4]
-	for string(s) != "data" {
-		c += 1
-		if c >= max {
-			break
-		}
-		s = audioData[c : c+4]
+// encode converts the pcm audio of trk to the ATRAC3 of df while it is read
+func (trk *Track) encode(df DiscFormat) error {
+	if df == trk.DiscFormat {
+		return nil
 	}
-	if string(s) != "data" {
-		return nil, errors.New("corrupt wav container")
+	var format WireFormat
+	switch df {
+	case DfLP2:
+		format = WfLP2
+	case DfLP4:
+		format = WfLP4
+	default:
+		return fmt.Errorf("track: can not encode to disc format %d, must be DfLP2 or DfLP4", df)
+	}
+	if trk.Format != WfPCM {
+		return fmt.Errorf("track: can not encode disc format %d to %d, only pcm can be encoded", trk.DiscFormat, df)
+	}
+	c, err := registeredCodec()
+	if err != nil {
+		return err
 	}
-	audioData = audioData[c+8:] // cut header
 
-	// filter metadata if available
-	max = len(audioData) - 4
-	inf := c
-	s = audioData[inf : inf+4]
-	for string(s) != "LIST" {
-		inf += 1
-		if inf >= max {
-			break
-		}
-		s = audioData[inf : inf+4]
+	channels := 2
+	if trk.DiscFormat == DfMonoSP {
+		channels = 1
 	}
-	if string(s) == "LIST" {
-		if md.debug {
-			log.Printf("!! found leading metadata starting @ %d - cutting.", inf)
-		}
-		audioData = audioData[:inf-1]
+	samples := trk.size / (2 * channels)
+	src, size, err := c.NewEncoder(io.LimitReader(trk.source, int64(samples*2*channels)), channels, samples, df)
+	if err != nil {
+		return err
 	}
+	trk.source = src
+	trk.size = size
+	trk.Format = format
+	trk.DiscFormat = df
+	return nil
+}
 
-	switch trk.Format {
-	case WfPCM:
-		// byte-swap the little-endian audio data, NetMD expects big-endian
-		for i := 0; i < len(audioData); i += 2 {
-			first := audioData[i]
-			audioData[i] = audioData[i+1]
-			audioData[i+1] = first
+func newTrack(title string) *Track {
+	return &Track{
+		Format:     WfPCM,
+		DiscFormat: DfStereoSP,
+		Title:      title,
+		Metadata:   &Metadata{},
+	}
+}
+
+// prepareTrack sets the title, the padding and number of frames and the cipher once the audio source of trk is known
+func (md *NetMD) prepareTrack(trk *Track) (err error) {
+	trk.key = md.ekb.CreateKey()
+	trk.iv = md.ekb.iv // first iv doesn't matter
+
+	if trk.Title == "" {
+		template := md.titleTemplate
+		if template == "" {
+			template = DefaultTitleTemplate
 		}
-	case WfLP2:
-		break
-	case WfLP4:
-		return nil, errors.New("WireFormat LP4 is currently not supported")
+		trk.Title = trk.Metadata.Format(template)
+	}
+
+	// pcm is sent as interleaved stereo, the device records a single channel when the disc format is DfMonoSP
+	if trk.Format == WfPCM && trk.DiscFormat == DfMonoSP {
+		trk.source = &monoReader{r: trk.source}
+		trk.size *= 2
 	}
 
 	// add padding when data length does not fit the frame size
-	if len(audioData)%FrameSize[trk.Format] != 0 {
-		trk.Padding = FrameSize[trk.Format] - (len(audioData) % FrameSize[trk.Format])
-		audioData = append(audioData, make([]byte, trk.Padding)...)
+	if trk.size%FrameSize[trk.Format] != 0 {
+		trk.Padding = FrameSize[trk.Format] - (trk.size % FrameSize[trk.Format])
+	}
+	trk.Frames = (trk.size + trk.Padding) / FrameSize[trk.Format]
+
+	trk.block, err = des.NewCipher(trk.key)
+	return
+}
+
+// nextPacket returns the next encrypted Packet to send or nil when all data was returned,
+// for a streamed Track the chunk is read, byte-swapped, padded and encrypted on the fly
+func (trk *Track) nextPacket() (*Packet, error) {
+	if trk.source == nil {
+		if trk.position >= len(trk.Packets) {
+			return nil, nil
+		}
+		p := trk.Packets[trk.position]
+		trk.position++
+		return p, nil
 	}
 
-	trk.Frames = len(audioData) / FrameSize[trk.Format]
+	total := trk.size + trk.Padding
+	if trk.position >= total {
+		return nil, nil
+	}
 
-	cipherBlock, err := des.NewCipher(trk.key)
-	if err != nil {
-		return
+	chunkSize := 0x80000 //0x00100000
+	if trk.position == 0 {
+		chunkSize -= 24
 	}
 
-	trk.position = 0
-	iv := md.ekb.iv // first iv doesn't matter
+	// the last (or only) packet ?
+	if (total - trk.position) < chunkSize {
+		chunkSize = total - trk.position // resize
+	}
 
-	for trk.position < len(audioData) {
+	packet := &Packet{
+		first: trk.position == 0,
+		data:  make([]byte, chunkSize),
+	}
 
-		chunkSize := 0x80000 //0x00100000
-		if trk.position == 0 {
-			chunkSize -= 24
+	// everything after the audio data is padding which is left zero
+	n := trk.size - trk.position
+	if n > chunkSize {
+		n = chunkSize
+	}
+	if n > 0 {
+		if _, err := io.ReadFull(trk.source, packet.data[:n]); err != nil {
+			return nil, err
 		}
+	}
 
-		// the last (or only) packet ?
-		if (len(audioData) - trk.position) < chunkSize {
-			chunkSize = len(audioData) - trk.position // resize
+	if trk.Format == WfPCM {
+		// byte-swap the little-endian audio data, NetMD expects big-endian
+		for i := 0; i+1 < n; i += 2 {
+			packet.data[i], packet.data[i+1] = packet.data[i+1], packet.data[i]
 		}
+	}
 
-		packet := &Packet{
-			first: trk.position == 0,
-			data:  make([]byte, chunkSize),
-		}
+	encryptor := cipher.NewCBCEncrypter(trk.block, trk.iv)
+	encryptor.CryptBlocks(packet.data, packet.data)
 
-		encryptor := cipher.NewCBCEncrypter(cipherBlock, iv)
-		encryptor.CryptBlocks(packet.data, audioData[trk.position:trk.position+chunkSize])
+	trk.iv = packet.data[chunkSize-8:]
+	trk.position += chunkSize
+	return packet, nil
+}
 
-		iv = packet.data[chunkSize-8:]
-		trk.position += chunkSize
-		trk.Packets = append(trk.Packets, packet)
+// rewind prepares the Track to be sent (again)
+func (trk *Track) rewind() error {
+	if trk.source != nil && trk.position != 0 {
+		return errors.New("streamed track was already sent")
 	}
-
-	return
+	if trk.source == nil {
+		trk.position = 0
+	}
+	return nil
 }
@@ -0,0 +1,127 @@
+package netmd
+
+import (
+	"errors"
+	"github.com/enimatek-nl/gousb"
+	"log"
+)
+
+// Transport is the low level channel the NetMD commands are sent over, by default this is the usb connection
+// but it can be replaced to wrap, test or drive a device over any other channel
+type Transport interface {
+	// ControlOut sends a vendor control request with data to the device
+	ControlOut(request uint8, data []byte) (int, error)
+	// ControlIn reads the response of a vendor control request in to data
+	ControlIn(request uint8, data []byte) (int, error)
+	// Poll reads the (4 byte) status of the device in to data
+	Poll(data []byte) (int, error)
+	// BulkOut writes data to the bulk out endpoint
+	BulkOut(data []byte) (int, error)
+	// BulkIn reads data from the bulk in endpoint
+	BulkIn(data []byte) (int, error)
+	// Close releases the underlying channel
+	Close() error
+}
+
+type usbTransport struct {
+	debug bool
+	index int
+	devs  []*gousb.Device
+	ctx   *gousb.Context
+	out   *gousb.OutEndpoint
+	in    *gousb.InEndpoint
+}
+
+// newUsbTransport opens all compatible devices and claims the endpoints of the device at index
+func newUsbTransport(index int, debug bool) (t *usbTransport, err error) {
+	t = &usbTransport{
+		index: index,
+		debug: debug,
+	}
+
+	t.ctx = gousb.NewContext()
+	t.devs, err = t.ctx.OpenDevices(func(desc *gousb.DeviceDesc) bool {
+		for _, d := range Devices {
+			if d.deviceId == desc.Product && d.vendorId == desc.Vendor {
+				if t.debug {
+					log.Printf("Found %s", d.name)
+				}
+				return true
+			}
+		}
+		return false
+	})
+
+	if err != nil {
+		t.Close()
+		return nil, &NoDeviceError{Index: index, Found: len(t.devs), Err: err}
+	}
+
+	if len(t.devs) == 0 || len(t.devs) <= t.index {
+		t.Close()
+		return nil, &NoDeviceError{Index: index, Found: len(t.devs)}
+	}
+
+	for num := range t.devs[t.index].Desc.Configs {
+		config, _ := t.devs[t.index].Config(num)
+		for _, desc := range config.Desc.Interfaces {
+			intf, _ := config.Interface(desc.Number, 0)
+			for _, endpointDesc := range intf.Setting.Endpoints {
+				switch endpointDesc.Direction {
+				case gousb.EndpointDirectionOut:
+					if t.out, err = intf.OutEndpoint(endpointDesc.Number); err != nil {
+						t.Close()
+						return nil, err
+					}
+				case gousb.EndpointDirectionIn:
+					if endpointDesc.TransferType != gousb.TransferTypeBulk {
+						continue
+					}
+					// only the MZ-RH1 uploads audio over the bulk in endpoint, other devices may not have one
+					if t.in, err = intf.InEndpoint(endpointDesc.Number); err != nil {
+						t.Close()
+						return nil, err
+					}
+				}
+				if t.debug {
+					log.Printf("%s", endpointDesc)
+				}
+			}
+			config.Close()
+		}
+	}
+	return
+}
+
+func (t *usbTransport) ControlOut(request uint8, data []byte) (int, error) {
+	return t.devs[t.index].Control(gousb.ControlOut|gousb.ControlVendor|gousb.ControlInterface, request, 0, 0, data)
+}
+
+func (t *usbTransport) ControlIn(request uint8, data []byte) (int, error) {
+	return t.devs[t.index].Control(gousb.ControlIn|gousb.ControlVendor|gousb.ControlInterface, request, 0, 0, data)
+}
+
+func (t *usbTransport) Poll(data []byte) (int, error) {
+	return t.ControlIn(0x01, data)
+}
+
+func (t *usbTransport) BulkOut(data []byte) (int, error) {
+	if t.out == nil {
+		return 0, errors.New("no bulk out endpoint found")
+	}
+	return t.out.Write(data)
+}
+
+func (t *usbTransport) BulkIn(data []byte) (int, error) {
+	if t.in == nil {
+		return 0, errors.New("no bulk in endpoint found")
+	}
+	return t.in.Read(data)
+}
+
+func (t *usbTransport) Close() error {
+	for _, d := range t.devs {
+		d.Close()
+	}
+	return t.ctx.Close()
+}
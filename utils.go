@@ -7,7 +7,6 @@ import (
 	"errors"
 	"fmt"
 	"log"
-	"strconv"
 )
 
 func intToHex16(num int16) []byte {
@@ -44,16 +43,37 @@ func hexToInt16(b []byte) uint16 {
 	return binary.BigEndian.Uint16(b)
 }
 
+func hexToInt32(b []byte) uint32 {
+	return binary.BigEndian.Uint32(b)
+}
+
 func hexToInt16LE(b []byte) uint16 {
 	return binary.LittleEndian.Uint16(b)
 }
 
-func hexToInt(b byte) uint64 {
-	v, err := strconv.ParseUint(fmt.Sprintf("%x", b), 10, 8)
-	if err != nil {
-		log.Fatal(err)
+// bcdToInt decodes the two bcd digits of b, eg. 0x59 is 59, a digit above 9 in a (garbled) reply is an error
+func bcdToInt(b byte) (uint64, error) {
+	if b>>4 > 9 || b&0x0f > 9 {
+		return 0, fmt.Errorf("netmd: invalid bcd byte %#02x", b)
+	}
+	return uint64(b>>4)*10 + uint64(b&0x0f), nil
+}
+
+// bcdToSeconds decodes the bcd hours, minutes and seconds in b into seconds
+func bcdToSeconds(b []byte) (uint64, error) {
+	var seconds uint64
+	for _, d := range b[:3] {
+		v, err := bcdToInt(d)
+		if err != nil {
+			return 0, err
+		}
+		seconds = seconds*60 + v
 	}
-	return v
+	return seconds, nil
+}
+
+func intToBcd(v uint64) byte {
+	return byte((v/10%10)<<4 | v%10)
 }
 
 /**
@@ -0,0 +1,84 @@
+package netmd
+
+import (
+	"bytes"
+	"testing"
+)
+
+// corruptingTransport garbles byte offset of the reply to the first command that starts with prefix
+type corruptingTransport struct {
+	Transport
+	prefix  []byte
+	offset  int
+	corrupt bool
+}
+
+func (c *corruptingTransport) ControlOut(request uint8, data []byte) (int, error) {
+	c.corrupt = c.prefix != nil && bytes.HasPrefix(data, c.prefix)
+	return c.Transport.ControlOut(request, data)
+}
+
+func (c *corruptingTransport) ControlIn(request uint8, data []byte) (int, error) {
+	n, err := c.Transport.ControlIn(request, data)
+	if c.corrupt && c.offset < n {
+		data[c.offset] = 0xaa
+		c.corrupt, c.prefix = false, nil
+	}
+	return n, err
+}
+
+func TestBcd(t *testing.T) {
+	tests := []struct {
+		b    byte
+		v    uint64
+		fail bool
+	}{
+		{0x00, 0, false},
+		{0x09, 9, false},
+		{0x10, 10, false},
+		{0x59, 59, false},
+		{0x99, 99, false},
+		{0x0a, 0, true},
+		{0xa0, 0, true},
+		{0xff, 0, true},
+	}
+	for _, tt := range tests {
+		if v, err := bcdToInt(tt.b); v != tt.v || (err != nil) != tt.fail {
+			t.Fatalf("bcd %#02x decoded to %d, %v", tt.b, v, err)
+		}
+		if tt.fail {
+			continue
+		}
+		if b := intToBcd(tt.v); b != tt.b {
+			t.Fatalf("%d encoded to %#02x, want %#02x", tt.v, b, tt.b)
+		}
+	}
+	if s, err := bcdToSeconds([]byte{0x01, 0x02, 0x03}); err != nil || s != 3723 {
+		t.Fatalf("bcd time decoded to %d, %v", s, err)
+	}
+	if _, err := bcdToSeconds([]byte{0x01, 0x6f, 0x03}); err == nil {
+		t.Fatal("invalid bcd time decoded")
+	}
+}
+
+func TestGarbledTimes(t *testing.T) {
+	// a garbled reply returns an error instead of ending the process
+	capacity := []byte{0x00, 0x18, 0x06, 0x02, 0x10, 0x10, 0x00}
+	length := []byte{0x00, 0x18, 0x06, 0x02, 0x20, 0x10, 0x01}
+	for _, offset := range []int{28, 36, 44} {
+		emu := NewEmulator()
+		md := NewNetMDWithTransport(&corruptingTransport{Transport: emu, prefix: capacity, offset: offset}, false)
+		if _, _, _, err := md.RequestDiscCapacity(); err == nil {
+			t.Fatalf("capacity with a garbled byte %d succeeded", offset)
+		}
+	}
+	emu := NewEmulator()
+	emu.AddTrack("A", EncSP, ChanStereo, 10)
+	md := NewNetMDWithTransport(&corruptingTransport{Transport: emu, prefix: length, offset: 29}, false)
+	if _, err := md.RequestTrackLength(0); err == nil {
+		t.Fatal("track length with a garbled byte succeeded")
+	}
+	if l, err := md.RequestTrackLength(0); err != nil || l != 10 {
+		t.Fatalf("track length %d, %v after the garbled reply", l, err)
+	}
+}
@@ -0,0 +1,161 @@
+package netmd
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+type EventType string
+
+const (
+	EvDiscInserted EventType = "disc_inserted"
+	EvDiscEjected  EventType = "disc_ejected"
+	EvPlay         EventType = "play"
+	EvPause        EventType = "pause"
+	EvStop         EventType = "stop"
+	EvFastForward  EventType = "fast_forward"
+	EvRewind       EventType = "rewind"
+	EvTrackChanged EventType = "track_changed"
+	EvPosition     EventType = "position"
+	EvBusy         EventType = "busy"
+	EvReady        EventType = "ready"
+	EvError        EventType = "error"
+)
+
+// Event is a change of the device found by Watch, Position is set for EvTrackChanged and EvPosition
+type Event struct {
+	Type     EventType
+	Status   OperatingStatus
+	Position Position
+	Error    error
+}
+
+// watchState is the result of a single poll of Watch
+type watchState struct {
+	disc     bool
+	status   OperatingStatus
+	position *Position // nil when the playback is stopped
+}
+
+// Watch polls the status, operating status and position of the device every interval until ctx is done and puts an
+// Event on the returned channel for every change, the first poll reports the current state. Failed polls are reported
+// as EvError, a poll waits while a track is sent or downloaded. The channel is closed when ctx is done
+func (md *NetMD) Watch(ctx context.Context, interval time.Duration) (<-chan Event, error) {
+	if interval <= 0 {
+		return nil, fmt.Errorf("watch: interval must be positive, got %s", interval)
+	}
+	c := make(chan Event)
+	go func() {
+		defer close(c)
+		t := time.NewTicker(interval)
+		defer t.Stop()
+
+		var prev *watchState
+		for {
+			cur, events := md.watchPoll(ctx, prev)
+			for _, ev := range events {
+				select {
+				case c <- ev:
+				case <-ctx.Done():
+					return
+				}
+			}
+			if cur != nil {
+				prev = cur
+			}
+			select {
+			case <-t.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return c, nil
+}
+
+// watchPoll polls the device once and returns its state and the events since prev, the state is nil when a query failed.
+// The queries do not run during a secure session, the device does not answer them in between the session commands
+func (md *NetMD) watchPoll(ctx context.Context, prev *watchState) (*watchState, []Event) {
+	if err := md.lockSession(ctx); err != nil {
+		return nil, nil
+	}
+	defer md.unlockSession()
+
+	fail := func(err error) (*watchState, []Event) {
+		if ctx.Err() != nil {
+			return nil, nil
+		}
+		return nil, []Event{{Type: EvError, Error: err}}
+	}
+
+	disc, err := md.RequestStatusContext(ctx)
+	if err != nil {
+		return fail(err)
+	}
+	status, err := md.RequestOperatingStatusContext(ctx)
+	if err != nil {
+		return fail(err)
+	}
+	cur := &watchState{disc: disc, status: status}
+	if ev := playbackEvent(status); ev != "" && ev != EvStop {
+		p, err := md.RequestPositionContext(ctx)
+		if err != nil {
+			return fail(err)
+		}
+		cur.position = &p
+	}
+
+	var events []Event
+	add := func(t EventType) {
+		ev := Event{Type: t, Status: status}
+		if cur.position != nil {
+			ev.Position = *cur.position
+		}
+		events = append(events, ev)
+	}
+
+	if prev == nil || prev.disc != disc {
+		if disc {
+			add(EvDiscInserted)
+		} else if prev != nil {
+			add(EvDiscEjected)
+		}
+	}
+	if busy := status == OpReadingTOC; prev == nil || busy != (prev.status == OpReadingTOC) {
+		if busy {
+			add(EvBusy)
+		} else {
+			add(EvReady)
+		}
+	}
+	if ev := playbackEvent(status); ev != "" && (prev == nil || ev != playbackEvent(prev.status)) {
+		add(ev)
+	}
+	if cur.position != nil {
+		if prev != nil && prev.position != nil && prev.position.Track != cur.position.Track {
+			add(EvTrackChanged)
+		}
+		if prev == nil || prev.position == nil || *prev.position != *cur.position {
+			add(EvPosition)
+		}
+	}
+	return cur, events
+}
+
+// playbackEvent returns the event of the playback state of status or an empty EventType when it is no playback state
+func playbackEvent(status OperatingStatus) EventType {
+	switch status {
+	case OpReady:
+		return EvStop
+	case OpPlaying:
+		return EvPlay
+	case OpPaused:
+		return EvPause
+	case OpFastForward:
+		return EvFastForward
+	case OpRewind:
+		return EvRewind
+	}
+	return ""
+}
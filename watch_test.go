@@ -0,0 +1,105 @@
+package netmd
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// expectEvents reads an event for every type in want from c and fails when they differ
+func expectEvents(t *testing.T, c <-chan Event, want ...EventType) []Event {
+	t.Helper()
+	var got []Event
+	for range want {
+		select {
+		case ev, ok := <-c:
+			if !ok {
+				t.Fatalf("channel closed after %v, want %v", got, want)
+			}
+			got = append(got, ev)
+		case <-time.After(2 * time.Second):
+			t.Fatalf("no event after %v, want %v", got, want)
+		}
+	}
+	for i, ev := range got {
+		if ev.Type != want[i] {
+			t.Fatalf("events %v, want %v", got, want)
+		}
+	}
+	return got
+}
+
+func TestWatch(t *testing.T) {
+	emu := NewEmulator()
+	emu.AddTrack("First", EncSP, ChanStereo, 10)
+	emu.AddTrack("Second", EncSP, ChanStereo, 10)
+	md := NewNetMDWithTransport(emu, false)
+
+	if _, err := md.Watch(context.Background(), 0); err == nil {
+		t.Fatal("watch with a zero interval succeeded")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c, err := md.Watch(ctx, 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	setBusy := func(busy bool) {
+		emu.mu.Lock()
+		emu.Busy = busy
+		emu.mu.Unlock()
+	}
+
+	expectEvents(t, c, EvDiscInserted, EvReady, EvStop)
+
+	// paused playback does not move, so the position is only reported once
+	if err = md.Pause(); err != nil {
+		t.Fatal(err)
+	}
+	if ev := expectEvents(t, c, EvPause, EvPosition); ev[1].Position.Track != 0 || ev[1].Status != OpPaused {
+		t.Fatalf("events %+v", ev)
+	}
+	if err = md.Next(); err != nil {
+		t.Fatal(err)
+	}
+	if ev := expectEvents(t, c, EvTrackChanged, EvPosition); ev[0].Position.Track != 1 || ev[1].Position.Track != 1 {
+		t.Fatalf("events %+v", ev)
+	}
+
+	setBusy(true)
+	expectEvents(t, c, EvBusy)
+	setBusy(false)
+	expectEvents(t, c, EvReady, EvPause, EvPosition)
+
+	if err = md.EjectDisc(); err != nil {
+		t.Fatal(err)
+	}
+	expectEvents(t, c, EvDiscEjected)
+
+	cancel()
+	select {
+	case _, ok := <-c:
+		if ok {
+			t.Fatal("event after cancel")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("channel not closed after cancel")
+	}
+}
+
+func TestWatchError(t *testing.T) {
+	md := NewNetMDWithTransport(&failingTransport{Transport: NewEmulator(), prefix: []byte{0x00, 0x18, 0x09, 0x80, 0x01, 0x02}}, false)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c, err := md.Watch(ctx, 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a failed poll is reported every interval and does not count as a change of the device
+	for _, ev := range expectEvents(t, c, EvError, EvError) {
+		if !errors.Is(ev.Error, errTransport) {
+			t.Fatalf("error event %+v", ev)
+		}
+	}
+}
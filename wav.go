@@ -0,0 +1,247 @@
+package netmd
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	waveFormatPCM        = 0x0001
+	waveFormatATRAC3     = 0x0270 // 624
+	waveFormatExtensible = 0xfffe
+)
+
+// wavHeader is the result of walking the chunks of a RIFF/WAVE file up to the start of the audio data
+type wavHeader struct {
+	format        int // format tag, for WAVE_FORMAT_EXTENSIBLE the tag of the sub format
+	channels      int
+	sampleRate    int
+	byteRate      int
+	blockAlign    int
+	bitsPerSample int
+	dataSize      int64
+	chunks        []*wavChunk // metadata chunks (LIST, id3) found before the data
+}
+
+type wavChunk struct {
+	id   string
+	data []byte
+}
+
+// readWavHeader reads r (of size bytes or -1 when unknown) until the start of the 'data' chunk,
+// every chunk before it is parsed (fmt) kept (LIST, id3) or skipped (fact, JUNK and unknown chunks)
+func readWavHeader(r io.Reader, size int64) (*wavHeader, error) {
+	riff := make([]byte, 12)
+	if _, err := io.ReadFull(r, riff); err != nil {
+		return nil, fmt.Errorf("wav: truncated riff header: %w", err)
+	}
+	if string(riff[0:4]) != "RIFF" {
+		return nil, errors.New("wav: riff header not found")
+	}
+	if string(riff[8:12]) != "WAVE" {
+		return nil, errors.New("wav: riff type is not WAVE")
+	}
+	read := int64(len(riff))
+
+	h := &wavHeader{}
+	hasFmt := false
+	for {
+		c := make([]byte, 8)
+		if _, err := io.ReadFull(r, c); err != nil {
+			if err == io.EOF {
+				return nil, errors.New("wav: data chunk not found")
+			}
+			return nil, fmt.Errorf("wav: truncated chunk header: %w", err)
+		}
+		read += 8
+		id := string(c[0:4])
+		chunkSize := int64(binary.LittleEndian.Uint32(c[4:8]))
+
+		if id == "data" {
+			if !hasFmt {
+				return nil, errors.New("wav: data chunk before fmt chunk")
+			}
+			// streamed wav files may have a zero or maximum size, the data then runs until the end
+			if chunkSize == 0 || chunkSize == 0xffffffff {
+				if size < 0 {
+					return nil, errors.New("wav: data size unknown")
+				}
+				chunkSize = size - read
+			}
+			if size >= 0 && size-read < chunkSize {
+				return nil, fmt.Errorf("wav: truncated data chunk: %d of %d bytes", size-read, chunkSize)
+			}
+			h.dataSize = chunkSize
+			return h, nil
+		}
+
+		// chunks are word aligned, odd sizes are followed by a pad byte
+		padded := chunkSize + chunkSize%2
+
+		switch id {
+		case "fmt ":
+			body := make([]byte, padded)
+			if _, err := io.ReadFull(r, body); err != nil {
+				return nil, fmt.Errorf("wav: truncated fmt chunk: %w", err)
+			}
+			if err := h.parseFmt(body[:chunkSize]); err != nil {
+				return nil, err
+			}
+			hasFmt = true
+		case "LIST", "id3 ", "ID3 ":
+			body := make([]byte, padded)
+			if _, err := io.ReadFull(r, body); err != nil {
+				return nil, fmt.Errorf("wav: truncated %s chunk: %w", id, err)
+			}
+			h.chunks = append(h.chunks, &wavChunk{id: id, data: body[:chunkSize]})
+		default: // fact, JUNK, PAD, bext, ...
+			n, err := io.CopyN(io.Discard, r, padded)
+			if err != nil && !(err == io.EOF && n == chunkSize) {
+				return nil, fmt.Errorf("wav: truncated %s chunk: %w", id, err)
+			}
+		}
+		read += padded
+	}
+}
+
+func (h *wavHeader) parseFmt(b []byte) error {
+	if len(b) < 16 {
+		return errors.New("wav: fmt chunk too small < 16")
+	}
+	h.format = int(binary.LittleEndian.Uint16(b[0:2]))
+	h.channels = int(binary.LittleEndian.Uint16(b[2:4]))
+	h.sampleRate = int(binary.LittleEndian.Uint32(b[4:8]))
+	h.byteRate = int(binary.LittleEndian.Uint32(b[8:12]))
+	h.blockAlign = int(binary.LittleEndian.Uint16(b[12:14]))
+	h.bitsPerSample = int(binary.LittleEndian.Uint16(b[14:16]))
+
+	if h.format == waveFormatExtensible {
+		// cbSize(2) validBits(2) channelMask(4) and the sub format guid which starts with the format tag
+		if len(b) < 40 {
+			return errors.New("wav: extensible fmt chunk too small < 40")
+		}
+		h.format = int(binary.LittleEndian.Uint16(b[24:26]))
+	}
+	return nil
+}
+
+// readWav sets the format and audio source of trk from the wav in hr, r is the underlying reader which is used to look
+// for metadata after the audio data when it is an io.Seeker
+func (trk *Track) readWav(hr, r io.Reader, size int64) error {
+	h, err := readWavHeader(hr, size)
+	if err != nil {
+		return err
+	}
+
+	// look for trailing metadata and return to the start of the audio data
+	if rs, ok := r.(io.Seeker); ok {
+		if pos, err := rs.Seek(0, io.SeekCurrent); err == nil {
+			if _, err := rs.Seek(pos+h.dataSize+h.dataSize%2, io.SeekStart); err == nil {
+				h.chunks = append(h.chunks, readWavTrailer(r)...)
+			}
+			if _, err := rs.Seek(pos, io.SeekStart); err != nil {
+				return err
+			}
+		}
+	}
+	trk.Metadata = newMetadata(h.chunks)
+
+	switch h.format {
+	case waveFormatATRAC3:
+		switch h.blockAlign {
+		case 384:
+			trk.Format = WfLP2
+			trk.DiscFormat = DfLP2
+		case 192:
+			trk.Format = WfLP4
+			trk.DiscFormat = DfLP4
+		default:
+			return errors.New("atrac3: block size not supported, must be 384 (LP2) or 192 (LP4)")
+		}
+	case waveFormatPCM:
+		if h.sampleRate != 44100 || h.bitsPerSample != 16 {
+			return errors.New("pcm: sample rate must be 44100 @ 16 bits")
+		}
+		switch h.channels {
+		case 1:
+			trk.DiscFormat = DfMonoSP
+		case 2:
+		default:
+			return errors.New("pcm: must be mono or stereo")
+		}
+	default:
+		return errors.New("wav: must be linear pcm (1) or atrac3 (624)")
+	}
+
+	trk.size = int(h.dataSize)
+	if trk.Format == WfPCM {
+		trk.size -= trk.size % 2
+	}
+	trk.source = io.LimitReader(r, int64(trk.size))
+	return nil
+}
+
+// write writes the RIFF header, the fmt chunk followed by the extra format bytes and the start of a data chunk of h.dataSize bytes
+func (h *wavHeader) write(w io.Writer, extra []byte) error {
+	f := make([]byte, 16)
+	binary.LittleEndian.PutUint16(f[0:2], uint16(h.format))
+	binary.LittleEndian.PutUint16(f[2:4], uint16(h.channels))
+	binary.LittleEndian.PutUint32(f[4:8], uint32(h.sampleRate))
+	binary.LittleEndian.PutUint32(f[8:12], uint32(h.byteRate))
+	binary.LittleEndian.PutUint16(f[12:14], uint16(h.blockAlign))
+	binary.LittleEndian.PutUint16(f[14:16], uint16(h.bitsPerSample))
+	if extra != nil {
+		cb := make([]byte, 2)
+		binary.LittleEndian.PutUint16(cb, uint16(len(extra)))
+		f = append(f, cb...)
+		f = append(f, extra...)
+	}
+
+	b := make([]byte, 20, 28+len(f))
+	copy(b[0:4], "RIFF")
+	binary.LittleEndian.PutUint32(b[4:8], uint32(int64(4+8+len(f)+8)+h.dataSize+h.dataSize%2))
+	copy(b[8:16], "WAVEfmt ")
+	binary.LittleEndian.PutUint32(b[16:20], uint32(len(f)))
+	b = append(b, f...)
+	d := make([]byte, 8)
+	copy(d[0:4], "data")
+	binary.LittleEndian.PutUint32(d[4:8], uint32(h.dataSize))
+	b = append(b, d...)
+	_, err := w.Write(b)
+	return err
+}
+
+// monoReader turns the 16 bit mono pcm of r into interleaved stereo by writing every sample to both channels
+type monoReader struct {
+	r       io.Reader
+	buf     []byte
+	odd     []byte // first byte of a sample that was split over two reads of r
+	pending []byte
+}
+
+func (m *monoReader) Read(p []byte) (int, error) {
+	if len(m.pending) == 0 {
+		if n := (len(p) + 3) / 4 * 2; cap(m.buf) < n {
+			m.buf = make([]byte, n)
+		}
+		b := m.buf[:(len(p)+3)/4*2]
+		c := copy(b, m.odd)
+		n, err := io.ReadAtLeast(m.r, b[c:], 2-c)
+		n += c
+		if n < 2 {
+			return 0, err
+		}
+		m.odd = append(m.odd[:0], b[n-n%2:n]...)
+		n -= n % 2
+		m.pending = make([]byte, 2*n)
+		for i := 0; i < n; i += 2 {
+			copy(m.pending[2*i:2*i+2], b[i:i+2])
+			copy(m.pending[2*i+2:2*i+4], b[i:i+2])
+		}
+	}
+	n := copy(p, m.pending)
+	m.pending = m.pending[n:]
+	return n, nil
+}
@@ -0,0 +1,200 @@
+package netmd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+// testChunk returns a RIFF chunk of id holding data followed by the pad byte of an odd size
+func testChunk(id string, data []byte) []byte {
+	c := make([]byte, 8, 8+len(data)+1)
+	copy(c[0:4], id)
+	binary.LittleEndian.PutUint32(c[4:8], uint32(len(data)))
+	c = append(c, data...)
+	if len(data)%2 != 0 {
+		c = append(c, 0x00)
+	}
+	return c
+}
+
+// testRiff returns a RIFF/WAVE file of the chunks
+func testRiff(chunks ...[]byte) []byte {
+	body := []byte("WAVE")
+	for _, c := range chunks {
+		body = append(body, c...)
+	}
+	return testChunk("RIFF", body)
+}
+
+// testFmt returns the body of a fmt chunk of 16 bit 44100 Hz audio in format
+func testFmt(format, channels int) []byte {
+	b := make([]byte, 16)
+	binary.LittleEndian.PutUint16(b[0:2], uint16(format))
+	binary.LittleEndian.PutUint16(b[2:4], uint16(channels))
+	binary.LittleEndian.PutUint32(b[4:8], 44100)
+	binary.LittleEndian.PutUint32(b[8:12], uint32(44100*2*channels))
+	binary.LittleEndian.PutUint16(b[12:14], uint16(2*channels))
+	binary.LittleEndian.PutUint16(b[14:16], 16)
+	return b
+}
+
+// testExtensible returns the body of a WAVE_FORMAT_EXTENSIBLE fmt chunk with the sub format tag of format
+func testExtensible(format, channels int) []byte {
+	b := testFmt(waveFormatExtensible, channels)
+	ext := make([]byte, 24)
+	binary.LittleEndian.PutUint16(ext[0:2], 22)
+	binary.LittleEndian.PutUint16(ext[2:4], 16)
+	binary.LittleEndian.PutUint16(ext[8:10], uint16(format))
+	return append(b, ext...)
+}
+
+func testInfo(title string) []byte {
+	return append([]byte("INFO"), testChunk("INAM", []byte(title+"\x00"))...)
+}
+
+func TestReadWavHeader(t *testing.T) {
+	audio := []byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06}
+	stereo := testChunk("fmt ", testFmt(waveFormatPCM, 2))
+	tests := []struct {
+		name   string
+		file   []byte
+		size   int64 // -1 when unknown, 0 for the length of file
+		format int
+		data   int64
+		chunks []string
+		err    string
+	}{
+		{name: "plain", file: testRiff(stereo, testChunk("data", audio)), format: waveFormatPCM, data: 6},
+		{name: "odd padding", file: testRiff(testChunk("JUNK", []byte{1, 2, 3}), stereo, testChunk("bext", []byte{1}), testChunk("data", audio)),
+			format: waveFormatPCM, data: 6},
+		{name: "fact, JUNK and LIST before data", file: testRiff(stereo, testChunk("fact", []byte{1, 0, 0, 0}), testChunk("JUNK", make([]byte, 28)),
+			testChunk("LIST", testInfo("Odd")), testChunk("data", audio)), format: waveFormatPCM, data: 6, chunks: []string{"LIST"}},
+		{name: "chunks after data are not read", file: testRiff(stereo, testChunk("data", audio), testChunk("LIST", testInfo("After")), testChunk("JUNK", []byte{1})),
+			format: waveFormatPCM, data: 6},
+		{name: "extensible", file: testRiff(testChunk("fmt ", testExtensible(waveFormatPCM, 2)), testChunk("data", audio)), format: waveFormatPCM, data: 6},
+		{name: "extensible atrac3", file: testRiff(testChunk("fmt ", testExtensible(waveFormatATRAC3, 2)), testChunk("data", audio)), format: waveFormatATRAC3, data: 6},
+		{name: "extensible too small", file: testRiff(testChunk("fmt ", testFmt(waveFormatExtensible, 2)), testChunk("data", audio)), err: "extensible fmt chunk too small"},
+		{name: "streamed data size", file: testRiff(stereo, testChunk("data", nil), audio), format: waveFormatPCM, data: 6},
+		{name: "streamed data size unknown", file: testRiff(stereo, testChunk("data", nil), audio), size: -1, err: "data size unknown"},
+		{name: "not a wav", file: testChunk("RIFF", []byte("AVI ")), err: "riff type is not WAVE"},
+		{name: "truncated riff header", file: []byte("RIFF\x00\x00"), err: "truncated riff header"},
+		{name: "truncated fmt", file: testRiff(stereo)[:30], err: "truncated fmt chunk"},
+		{name: "truncated chunk header", file: testRiff(stereo, testChunk("data", audio))[:40], err: "truncated chunk header"},
+		{name: "truncated JUNK", file: testRiff(stereo, testChunk("JUNK", make([]byte, 10)))[:50], err: "truncated JUNK chunk"},
+		{name: "truncated data", file: testRiff(stereo, testChunk("data", audio))[:46], err: "truncated data chunk: 2 of 6 bytes"},
+		{name: "no data", file: testRiff(stereo), err: "data chunk not found"},
+		{name: "data before fmt", file: testRiff(testChunk("data", audio), stereo), err: "data chunk before fmt chunk"},
+	}
+	readers := map[string]func(io.Reader) io.Reader{
+		"bytes":    func(r io.Reader) io.Reader { return r },
+		"one byte": iotest.OneByteReader,
+		"half":     iotest.HalfReader,
+	}
+	for _, tt := range tests {
+		for name, reader := range readers {
+			t.Run(tt.name+"/"+name, func(t *testing.T) {
+				size := tt.size
+				if size == 0 {
+					size = int64(len(tt.file))
+				}
+				r := reader(bytes.NewReader(tt.file))
+				h, err := readWavHeader(r, size)
+				if tt.err != "" {
+					if err == nil || !strings.Contains(err.Error(), tt.err) {
+						t.Fatalf("error %v, want %q", err, tt.err)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				var chunks []string
+				for _, c := range h.chunks {
+					chunks = append(chunks, c.id)
+				}
+				if h.format != tt.format || h.dataSize != tt.data || strings.Join(chunks, ",") != strings.Join(tt.chunks, ",") {
+					t.Fatalf("header %+v with chunks %v", h, chunks)
+				}
+				if d, _ := io.ReadAll(io.LimitReader(r, h.dataSize)); !bytes.Equal(d, audio) {
+					t.Fatalf("audio data % x", d)
+				}
+			})
+		}
+	}
+}
+
+func TestReadWavTrailer(t *testing.T) {
+	w := testRiff(testChunk("fmt ", testFmt(waveFormatPCM, 1)), testChunk("LIST", testInfo("Before")), testChunk("data", make([]byte, 8)),
+		testChunk("JUNK", []byte{1}), testChunk("LIST", testInfo("After")))
+
+	trk, err := readTrack("", bytes.NewReader(w), int64(len(w)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if trk.Metadata.Title != "After" || trk.DiscFormat != DfMonoSP || trk.size != 8 {
+		t.Fatalf("track %+v with metadata %+v", trk, trk.Metadata)
+	}
+	if d, _ := io.ReadAll(trk.source); len(d) != 8 {
+		t.Fatalf("read %d bytes of audio after the trailer", len(d))
+	}
+
+	// the trailer is only read when the file can seek
+	trk, err = readTrack("", iotest.HalfReader(bytes.NewReader(w)), int64(len(w)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if trk.Metadata.Title != "Before" {
+		t.Fatalf("title %q without seeking", trk.Metadata.Title)
+	}
+}
+
+func TestMonoReader(t *testing.T) {
+	mono := make([]byte, 1001*2)
+	for i := range mono {
+		mono[i] = byte(i)
+	}
+	want := make([]byte, 0, 2*len(mono))
+	for i := 0; i < len(mono); i += 2 {
+		want = append(want, mono[i], mono[i+1], mono[i], mono[i+1])
+	}
+	readers := map[string]func(io.Reader) io.Reader{
+		"bytes":    func(r io.Reader) io.Reader { return r },
+		"one byte": iotest.OneByteReader,
+		"half":     iotest.HalfReader,
+	}
+	for name, reader := range readers {
+		t.Run(name, func(t *testing.T) {
+			got, err := io.ReadAll(iotest.HalfReader(&monoReader{r: reader(bytes.NewReader(mono))}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Fatalf("read %d bytes, want %d", len(got), len(want))
+			}
+		})
+	}
+}
+
+func TestSendMonoFromHalfReader(t *testing.T) {
+	w := testWav(1, 1)
+	var data [][]byte
+	for _, r := range []io.Reader{bytes.NewReader(w), iotest.HalfReader(bytes.NewReader(w))} {
+		emu := NewEmulator()
+		md := NewNetMDWithTransport(emu, false)
+		trk, err := md.NewTrackFromReader("Mono", r, int64(len(w)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = md.SendTrack(trk, nil); err != nil {
+			t.Fatal(err)
+		}
+		data = append(data, emu.Tracks[0].Data)
+	}
+	if !bytes.Equal(data[0], data[1]) {
+		t.Fatal("the audio sent from a HalfReader differs")
+	}
+}